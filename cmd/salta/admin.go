@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Ackar/salta/geocoding"
+	log "github.com/sirupsen/logrus"
+)
+
+// adminHandler serves the admin API used to load and unload countries at
+// runtime:
+//
+//	GET    /admin/countries       lists the loaded countries
+//	PUT    /admin/countries/{cc}  loads or reloads a country in the background
+//	DELETE /admin/countries/{cc}  unloads a country
+//
+// Requests must be authenticated with "Authorization: Bearer <admin.token>".
+type adminHandler struct {
+	// ctx is canceled on shutdown, stopping the loads in progress
+	ctx      context.Context
+	geocoder *geocoding.ReverseGeocoder
+	token    string
+}
+
+func newAdminHandler(ctx context.Context, g *geocoding.ReverseGeocoder, token string) *adminHandler {
+	return &adminHandler{
+		ctx:      ctx,
+		geocoder: g,
+		token:    token,
+	}
+}
+
+func (a *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="salta admin"`)
+		writeError(w, http.StatusUnauthorized, "unauthorized", "missing or invalid admin token")
+		return
+	}
+
+	if r.URL.Path == "/admin/countries" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+			return
+		}
+		a.listCountries(w)
+		return
+	}
+
+	country := strings.TrimPrefix(r.URL.Path, "/admin/countries/")
+	if country == r.URL.Path || strings.Contains(country, "/") {
+		writeError(w, http.StatusNotFound, "not_found", "no such endpoint")
+		return
+	}
+	country = strings.ToLower(country)
+
+	switch r.Method {
+	case http.MethodPut:
+		a.loadCountry(w, country)
+	case http.MethodDelete:
+		a.unloadCountry(w, country)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+	}
+}
+
+func (a *adminHandler) authorized(r *http.Request) bool {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+	token := header[len(prefix):]
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+func (a *adminHandler) listCountries(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(struct {
+		Countries []string
+	}{
+		Countries: a.geocoder.LoadedCountries(),
+	})
+	if err != nil {
+		log.WithError(err).Error("error encoding response")
+	}
+}
+
+// loadCountry starts loading a country and returns right away as cloning and
+// indexing can take a while, the progress is reported by /status.
+func (a *adminHandler) loadCountry(w http.ResponseWriter, country string) {
+	if !contains(allCountries, country) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "unknown country")
+		return
+	}
+
+	go func() {
+		err := a.geocoder.LoadCountryContext(a.ctx, country)
+		if err != nil {
+			log.WithError(err).WithField("country", country).Error("error loading country")
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *adminHandler) unloadCountry(w http.ResponseWriter, country string) {
+	err := a.geocoder.UnloadCountry(country)
+	if errors.Is(err, geocoding.ErrUnknownCountry) {
+		writeError(w, http.StatusNotFound, "not_found", "country not loaded")
+		return
+	}
+	if err != nil {
+		log.WithError(err).WithField("country", country).Error("error unloading country")
+		writeError(w, http.StatusInternalServerError, "internal", "error unloading country")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Ackar/salta/geocoding"
+)
+
+func TestAdminAuth(t *testing.T) {
+	g := geocoding.NewReverseGeocoder("", "", nil, nil)
+	h := newAdminHandler(context.Background(), g, "s3cret")
+
+	tests := []struct {
+		authorization string
+		wantStatus    int
+	}{
+		{authorization: "Bearer s3cret", wantStatus: http.StatusOK},
+		{authorization: "", wantStatus: http.StatusUnauthorized},
+		{authorization: "s3cret", wantStatus: http.StatusUnauthorized},
+		{authorization: "Bearer", wantStatus: http.StatusUnauthorized},
+		{authorization: "Bearer ", wantStatus: http.StatusUnauthorized},
+		{authorization: "Bearer wrong", wantStatus: http.StatusUnauthorized},
+		{authorization: "Bearer s3cret2", wantStatus: http.StatusUnauthorized},
+		{authorization: "Basic s3cret", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/admin/countries", nil)
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%q: got status %d, want %d", tt.authorization, w.Code, tt.wantStatus)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%q: got content type %q, want JSON", tt.authorization, ct)
+		}
+	}
+}
+
+func TestAdminErrors(t *testing.T) {
+	g := geocoding.NewReverseGeocoder("", "", nil, nil)
+	h := newAdminHandler(context.Background(), g, "s3cret")
+
+	tests := []struct {
+		method, path string
+		wantStatus   int
+		wantCode     string
+	}{
+		{method: http.MethodPost, path: "/admin/countries", wantStatus: http.StatusMethodNotAllowed, wantCode: "method_not_allowed"},
+		{method: http.MethodPost, path: "/admin/countries/nz", wantStatus: http.StatusMethodNotAllowed, wantCode: "method_not_allowed"},
+		{method: http.MethodPut, path: "/admin/countries/xx", wantStatus: http.StatusBadRequest, wantCode: "invalid_request"},
+		{method: http.MethodDelete, path: "/admin/countries/nz", wantStatus: http.StatusNotFound, wantCode: "not_found"},
+		{method: http.MethodGet, path: "/admin/countries/nz/foo", wantStatus: http.StatusNotFound, wantCode: "not_found"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		r.Header.Set("Authorization", "Bearer s3cret")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		var e apiError
+		err := json.Unmarshal(w.Body.Bytes(), &e)
+		if w.Code != tt.wantStatus || err != nil || e.Code != tt.wantCode {
+			t.Errorf("%s %s: got status %d and body %s, want status %d and code %q", tt.method, tt.path, w.Code, w.Body, tt.wantStatus, tt.wantCode)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Ackar/salta/geocoding"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// apiKey is an API key and the data it gives access to, an empty list means
+// no restriction. Rate and Burst override the default key rate limit.
+type apiKey struct {
+	Name       string
+	Key        string
+	Countries  []string
+	PlaceTypes []string `mapstructure:"place_types"`
+	Rate       float64
+	Burst      int
+}
+
+// allowsPlace reports whether the key gives access to a place. A nil key, when
+// authentication is disabled, gives access to all places.
+func (k *apiKey) allowsPlace(p *geocoding.Place) bool {
+	if k == nil {
+		return true
+	}
+	if len(k.PlaceTypes) > 0 && !contains(k.PlaceTypes, p.PlaceType) {
+		return false
+	}
+	if len(k.Countries) > 0 && !contains(k.Countries, strings.ToLower(p.Country)) {
+		return false
+	}
+
+	return true
+}
+
+// filterLocation removes the places the key doesn't give access to. Nothing
+// is returned for locations outside of the key countries, not even the
+// timezone.
+func (k *apiKey) filterLocation(loc *geocoding.Location) *geocoding.Location {
+	if k == nil || (len(k.Countries) == 0 && len(k.PlaceTypes) == 0) {
+		return loc
+	}
+
+	res := loc.Filter(k.allowsPlace)
+	if len(k.Countries) > 0 && len(res.Places) == 0 {
+		return &geocoding.Location{}
+	}
+
+	return res
+}
+
+type apiKeyContextKey struct{}
+
+// apiKeyFromContext returns the key of the request, nil when authentication
+// is disabled.
+func apiKeyFromContext(ctx context.Context) *apiKey {
+	k, _ := ctx.Value(apiKeyContextKey{}).(*apiKey)
+	return k
+}
+
+// authenticator checks the API keys of the lookup APIs, it is disabled when no
+// keys are configured.
+type authenticator struct {
+	header string
+	keys   map[string]*apiKey
+}
+
+// newAuthenticator returns an authenticator with the keys of the config and
+// of the keys file, or nil if there are none.
+func newAuthenticator() (*authenticator, error) {
+	keys, err := loadAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	a := &authenticator{
+		header: viper.GetString("auth.header"),
+		keys:   make(map[string]*apiKey, len(keys)),
+	}
+	for i := range keys {
+		a.keys[keys[i].Key] = &keys[i]
+	}
+
+	return a, nil
+}
+
+// loadAPIKeys returns the keys of the config followed by those of the keys
+// file.
+func loadAPIKeys() ([]apiKey, error) {
+	var keys []apiKey
+	err := viper.UnmarshalKey("auth.keys", &keys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth.keys: %w", err)
+	}
+
+	if path := viper.GetString("auth.keys_file"); path != "" {
+		v := viper.New()
+		v.SetConfigFile(path)
+		err := v.ReadInConfig()
+		if err != nil {
+			return nil, fmt.Errorf("error reading keys file: %w", err)
+		}
+
+		var fileKeys []apiKey
+		err = v.UnmarshalKey("keys", &fileKeys)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keys file: %w", err)
+		}
+		keys = append(keys, fileKeys...)
+	}
+
+	return keys, nil
+}
+
+// hasRateLimits reports whether a key has its own rate limit.
+func (a *authenticator) hasRateLimits() bool {
+	if a == nil {
+		return false
+	}
+	for _, k := range a.keys {
+		if k.Rate > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *authenticator) lookup(key string) (*apiKey, bool) {
+	if key == "" {
+		return nil, false
+	}
+	k, ok := a.keys[key]
+	return k, ok
+}
+
+// wrap returns a handler that rejects the requests without a valid key, and
+// passes the key to h through the request context.
+func (a *authenticator) wrap(h http.Handler) http.Handler {
+	if a == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k, ok := a.lookup(r.Header.Get(a.header))
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "missing or invalid API key")
+			return
+		}
+
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, k)))
+	})
+}
+
+// grpcContext authenticates an RPC, the key is read from the metadata with the
+// same name as the HTTP header.
+func (a *authenticator) grpcContext(ctx context.Context) (context.Context, error) {
+	var key string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(a.header); len(values) > 0 {
+		key = values[0]
+	}
+	k, ok := a.lookup(key)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing or invalid API key")
+	}
+
+	return context.WithValue(ctx, apiKeyContextKey{}, k), nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Ackar/salta/geocoding"
+	"github.com/Ackar/salta/saltapb"
+	graphql "github.com/graph-gophers/graphql-go"
+	"google.golang.org/grpc/metadata"
+)
+
+// testKeys are API keys giving access to all places, to localities only, to
+// country XX only and to country YY only.
+var testKeys = map[string]*apiKey{
+	"all":        {Name: "all", Key: "all"},
+	"localities": {Name: "localities", Key: "localities", PlaceTypes: []string{"locality"}},
+	"xx":         {Name: "xx", Key: "xx", Countries: []string{"xx"}},
+	"yy":         {Name: "yy", Key: "yy", Countries: []string{"yy"}},
+}
+
+func testLoadedGeocoder(t *testing.T) *geocoding.ReverseGeocoder {
+	t.Helper()
+
+	g := testGeocoder()
+	err := g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return g
+}
+
+func TestFilterLocation(t *testing.T) {
+	loc := testLoadedGeocoder(t).LocationFromLatLng(48.5, 2.5)
+	if loc.Locality != "Testville" || loc.Region != "Testregion" {
+		t.Fatalf("got %+v, want Testville in Testregion", loc)
+	}
+
+	tests := []struct {
+		key                      string
+		wantLocality, wantRegion string
+	}{
+		{key: "all", wantLocality: "Testville", wantRegion: "Testregion"},
+		{key: "localities", wantLocality: "Testville"},
+		{key: "xx", wantLocality: "Testville", wantRegion: "Testregion"},
+		{key: "yy"},
+	}
+	for _, tt := range tests {
+		got := testKeys[tt.key].filterLocation(loc)
+		if got.Locality != tt.wantLocality || got.Region != tt.wantRegion {
+			t.Errorf("key %q: got locality %q and region %q, want %q and %q", tt.key, got.Locality, got.Region, tt.wantLocality, tt.wantRegion)
+		}
+		for placeType := range got.Places {
+			if !testKeys[tt.key].allowsPlace(got.Places[placeType]) {
+				t.Errorf("key %q: got place %q", tt.key, placeType)
+			}
+		}
+	}
+
+	// the location itself is left untouched
+	if loc.Region != "Testregion" || len(loc.Places) != 2 {
+		t.Errorf("location modified: %+v", loc)
+	}
+}
+
+func TestRESTPlaceScope(t *testing.T) {
+	auth := &authenticator{header: "X-API-Key", keys: testKeys}
+	api := newRESTAPI(testLoadedGeocoder(t), auth, nil)
+
+	tests := []struct {
+		key    string
+		id     string
+		status int
+	}{
+		{key: "all", id: "1", status: 200},
+		{key: "all", id: "2", status: 200},
+		{key: "localities", id: "1", status: 200},
+		{key: "localities", id: "2", status: 404},
+		{key: "xx", id: "2", status: 200},
+		{key: "yy", id: "1", status: 404},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/v1/places/"+tt.id, nil)
+		r.Header.Set("X-API-Key", tt.key)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("place %s with key %q: got status %d, want %d", tt.id, tt.key, w.Code, tt.status)
+		}
+	}
+}
+
+func TestGraphQLPlaceScope(t *testing.T) {
+	auth := &authenticator{header: "X-API-Key", keys: testKeys}
+	s := graphql.MustParseSchema(schema, newGraphqlResolver(testLoadedGeocoder(t)), graphql.UseFieldResolvers())
+	h := auth.wrap(&graphqlHandler{schema: s})
+
+	tests := []struct {
+		key        string
+		wantPlace  string
+		wantParent string
+	}{
+		{key: "all", wantPlace: "Testville", wantParent: "Testregion"},
+		{key: "localities", wantPlace: "Testville"},
+		{key: "yy"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/query", strings.NewReader(`{"query": "{ place(id: 1) { name parent { name } } }"}`))
+		r.Header.Set("X-API-Key", tt.key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		var resp struct {
+			Data struct {
+				Place *struct {
+					Name   string
+					Parent *struct {
+						Name string
+					}
+				}
+			}
+			Errors []interface{}
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil || len(resp.Errors) > 0 {
+			t.Errorf("key %q: invalid response %s", tt.key, w.Body)
+			continue
+		}
+
+		var place, parent string
+		if p := resp.Data.Place; p != nil {
+			place = p.Name
+			if p.Parent != nil {
+				parent = p.Parent.Name
+			}
+		}
+		if place != tt.wantPlace || parent != tt.wantParent {
+			t.Errorf("key %q: got place %q with parent %q, want %q with parent %q", tt.key, place, parent, tt.wantPlace, tt.wantParent)
+		}
+	}
+}
+
+func TestGRPCScope(t *testing.T) {
+	auth := &authenticator{header: "X-API-Key", keys: testKeys}
+	conn, _ := testGRPCServer(t, testLoadedGeocoder(t), auth, nil)
+	client := saltapb.NewGeocoderClient(conn)
+
+	tests := []struct {
+		key                      string
+		wantLocality, wantRegion string
+	}{
+		{key: "all", wantLocality: "Testville", wantRegion: "Testregion"},
+		{key: "localities", wantLocality: "Testville"},
+		{key: "yy"},
+	}
+	for _, tt := range tests {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", tt.key)
+		loc, err := client.ReverseGeocode(ctx, &saltapb.ReverseGeocodeRequest{Latitude: 48.5, Longitude: 2.5})
+		if err != nil {
+			t.Errorf("key %q: %v", tt.key, err)
+			continue
+		}
+		if loc.Locality != tt.wantLocality || loc.Region != tt.wantRegion {
+			t.Errorf("key %q: got locality %q and region %q, want %q and %q", tt.key, loc.Locality, loc.Region, tt.wantLocality, tt.wantRegion)
+		}
+	}
+}
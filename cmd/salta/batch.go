@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/Ackar/salta/geocoding"
+	log "github.com/sirupsen/logrus"
+)
+
+// locationColumns are the columns appended to CSV rows.
+var locationColumns = []string{
+	"Campus",
+	"Locality",
+	"MarketArea",
+	"Neighbourhood",
+	"Borough",
+	"Microhood",
+	"County",
+	"MacroCounty",
+	"LocalAdmin",
+	"Region",
+	"MacroRegion",
+	"Country",
+	"LocalityDistance",
+	"Timezone",
+	"UTCOffset",
+}
+
+func locationValues(l *geocoding.Location) []string {
+	var dist string
+	if l.LocalityDistance != nil {
+		dist = strconv.FormatFloat(*l.LocalityDistance, 'f', -1, 64)
+	}
+
+	return []string{
+		l.Campus,
+		l.Locality,
+		l.MarketArea,
+		l.Neighbourhood,
+		l.Borough,
+		l.Microhood,
+		l.County,
+		l.MacroCounty,
+		l.LocalAdmin,
+		l.Region,
+		l.MacroRegion,
+		l.Country,
+		dist,
+		l.Timezone,
+		l.UTCOffset,
+	}
+}
+
+// locator looks up the location of coordinates, it is implemented by
+// geocoding.ReverseGeocoder.
+type locator interface {
+	LocationFromLatLng(lat, lng float64) *geocoding.Location
+}
+
+// batchRow is a row being geocoded, done is closed once location is set.
+type batchRow struct {
+	record   []string // CSV
+	raw      []byte   // NDJSON
+	lat, lng float64
+	invalid  bool
+	// hasField is set when the NDJSON object already has the location field
+	hasField bool
+
+	location *geocoding.Location
+	done     chan struct{}
+}
+
+// batchOptions are the options of the batch command.
+type batchOptions struct {
+	format   string
+	lat, lng string
+	noHeader bool
+	field    string
+	workers  int
+}
+
+// cmdBatch geocodes the rows of a CSV or NDJSON file, or stdin, and writes
+// them with their location appended. Rows are geocoded in parallel
+// and written in order.
+func cmdBatch(fs *flag.FlagSet, args []string) {
+	var opts batchOptions
+	fs.StringVar(&opts.format, "format", "", "input format: csv or ndjson, guessed from the file extension by default")
+	fs.StringVar(&opts.lat, "lat", "lat", "latitude column or field, a 0-based index with -no-header")
+	fs.StringVar(&opts.lng, "lng", "lng", "longitude column or field, a 0-based index with -no-header")
+	fs.BoolVar(&opts.noHeader, "no-header", false, "the CSV input has no header row")
+	fs.StringVar(&opts.field, "field", "location", "NDJSON field the location is written to")
+	fs.IntVar(&opts.workers, "workers", runtime.NumCPU(), "number of rows geocoded concurrently")
+	input := fs.String("i", "-", "input file, - for stdin")
+	output := fs.String("o", "-", "output file, - for stdout")
+	setup(fs, args, 0)
+	mustCheckConfig()
+
+	in := os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			log.WithError(err).Fatal("error opening input")
+		}
+		defer f.Close()
+		in = f
+
+		if opts.format == "" {
+			opts.format = formatFromExtension(*input)
+		}
+	}
+	if opts.format == "" {
+		opts.format = "csv"
+	}
+	if opts.workers < 1 {
+		opts.workers = 1
+	}
+
+	out := os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.WithError(err).Fatal("error creating output")
+		}
+		defer f.Close()
+		out = f
+	}
+
+	g := newGeocoder()
+	err := load(context.Background(), g, true)
+	if err != nil {
+		log.WithError(err).Fatal("error loading cache")
+	}
+
+	w := bufio.NewWriter(out)
+	switch opts.format {
+	case "csv":
+		err = batchCSV(g, opts, in, w)
+	case "ndjson", "jsonl":
+		err = batchNDJSON(g, opts, in, w)
+	default:
+		log.Fatalf("unknown format %q", opts.format)
+	}
+	if err != nil {
+		log.WithError(err).Fatal("error geocoding batch")
+	}
+
+	err = w.Flush()
+	if err != nil {
+		log.WithError(err).Fatal("error writing output")
+	}
+}
+
+func formatFromExtension(path string) string {
+	switch filepath.Ext(path) {
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	case ".csv":
+		return "csv"
+	}
+
+	return ""
+}
+
+// geocodeRows geocodes the rows sent by read with the given number of
+// workers, and passes them to write in the same order. It stops at the first
+// error.
+func geocodeRows(g locator, workers int, read func(rows chan<- *batchRow) error, write func(r *batchRow) error) error {
+	jobs := make(chan *batchRow, workers*64)
+	ordered := make(chan *batchRow, workers*64)
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range jobs {
+				if r.invalid {
+					r.location = &geocoding.Location{}
+				} else {
+					r.location = g.LocationFromLatLng(r.lat, r.lng)
+				}
+				close(r.done)
+			}
+		}()
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		rows := make(chan *batchRow)
+		go func() {
+			readErr <- read(rows)
+			close(rows)
+		}()
+
+		defer close(ordered)
+		defer close(jobs)
+		for r := range rows {
+			r.done = make(chan struct{})
+			select {
+			case ordered <- r:
+			case <-stop:
+				// drain the reader
+				for range rows {
+				}
+				return
+			}
+			jobs <- r
+		}
+	}()
+
+	var err error
+	var invalid int
+	for r := range ordered {
+		<-r.done
+		if r.invalid {
+			invalid++
+		}
+		if err == nil {
+			err = write(r)
+			if err != nil {
+				close(stop)
+			}
+		}
+	}
+	wg.Wait()
+
+	if invalid > 0 {
+		log.Warnf("%d rows without valid coordinates", invalid)
+	}
+	if err != nil {
+		return err
+	}
+
+	return <-readErr
+}
+
+func batchCSV(g locator, opts batchOptions, in io.Reader, out io.Writer) error {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	w := csv.NewWriter(out)
+
+	latCol, lngCol := -1, -1
+	if opts.noHeader {
+		var err error
+		latCol, err = strconv.Atoi(opts.lat)
+		if err != nil {
+			return fmt.Errorf("invalid latitude column index %q", opts.lat)
+		}
+		lngCol, err = strconv.Atoi(opts.lng)
+		if err != nil {
+			return fmt.Errorf("invalid longitude column index %q", opts.lng)
+		}
+	} else {
+		header, err := r.Read()
+		if err != nil {
+			return fmt.Errorf("error reading header: %w", err)
+		}
+		for i, h := range header {
+			switch h {
+			case opts.lat:
+				latCol = i
+			case opts.lng:
+				lngCol = i
+			}
+		}
+		if latCol < 0 || lngCol < 0 {
+			return fmt.Errorf("columns %q and %q not found in header", opts.lat, opts.lng)
+		}
+
+		err = w.Write(append(header, locationColumns...))
+		if err != nil {
+			return err
+		}
+	}
+
+	read := func(rows chan<- *batchRow) error {
+		for {
+			record, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			row := &batchRow{record: record, invalid: true}
+			if latCol < len(record) && lngCol < len(record) {
+				var ok bool
+				row.lat, row.lng, ok = parseLatLng(record[latCol], record[lngCol])
+				row.invalid = !ok
+			}
+			rows <- row
+		}
+	}
+	write := func(row *batchRow) error {
+		return w.Write(append(row.record, locationValues(row.location)...))
+	}
+
+	err := geocodeRows(g, opts.workers, read, write)
+	if err != nil {
+		return err
+	}
+	w.Flush()
+
+	return w.Error()
+}
+
+func batchNDJSON(g locator, opts batchOptions, in io.Reader, out io.Writer) error {
+	br := bufio.NewReader(in)
+
+	read := func(rows chan<- *batchRow) error {
+		for line := 1; ; line++ {
+			raw, err := br.ReadBytes('\n')
+			if len(bytes.TrimSpace(raw)) > 0 {
+				row := &batchRow{raw: bytes.TrimSpace(raw), invalid: true}
+
+				var fields map[string]interface{}
+				if json.Unmarshal(row.raw, &fields) == nil {
+					var ok bool
+					row.lat, row.lng, ok = parseLatLng(fields[opts.lat], fields[opts.lng])
+					row.invalid = !ok
+					_, row.hasField = fields[opts.field]
+				} else {
+					log.WithField("line", line).Warn("invalid JSON")
+				}
+				rows <- row
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	write := func(row *batchRow) error {
+		// append the location to the original object to keep its fields
+		// order
+		if row.invalid || len(row.raw) < 2 || row.raw[0] != '{' {
+			_, err := out.Write(append(row.raw, '\n'))
+			return err
+		}
+
+		location, err := json.Marshal(row.location)
+		if err != nil {
+			return err
+		}
+		if row.hasField {
+			obj, err := replaceField(row.raw, opts.field, location)
+			if err != nil {
+				return err
+			}
+			_, err = out.Write(append(obj, '\n'))
+			return err
+		}
+		field, err := json.Marshal(opts.field)
+		if err != nil {
+			return err
+		}
+
+		var b bytes.Buffer
+		obj := bytes.TrimSpace(row.raw[:len(row.raw)-1])
+		b.Write(obj)
+		if len(bytes.TrimSpace(obj[1:])) > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(field)
+		b.WriteByte(':')
+		b.Write(location)
+		b.WriteString("}\n")
+
+		_, err = out.Write(b.Bytes())
+		return err
+	}
+
+	return geocodeRows(g, opts.workers, read, write)
+}
+
+// replaceField returns the JSON object obj with the value of field replaced
+// by value, keeping the fields order.
+func replaceField(obj []byte, field string, value []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(obj))
+	_, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i := 0; dec.More(); i++ {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := t.(string)
+		var v json.RawMessage
+		err = dec.Decode(&v)
+		if err != nil {
+			return nil, err
+		}
+		if key == field {
+			v = value
+		}
+
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
+// parseLatLng parses coordinates given as strings or numbers, it returns
+// false if they are invalid.
+func parseLatLng(lat, lng interface{}) (float64, float64, bool) {
+	la, ok := parseCoordinate(lat)
+	if !ok {
+		return 0, 0, false
+	}
+	ln, ok := parseCoordinate(lng)
+	if !ok || !validCoordinates(la, ln) {
+		return 0, 0, false
+	}
+
+	return la, ln, true
+}
+
+func parseCoordinate(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+
+	return 0, false
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Ackar/salta/geocoding"
+)
+
+// stubLocator returns the coordinates as the locality, after a random delay
+// so that rows are geocoded out of order.
+type stubLocator struct {
+	lookups int64
+}
+
+func (s *stubLocator) LocationFromLatLng(lat, lng float64) *geocoding.Location {
+	atomic.AddInt64(&s.lookups, 1)
+	time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+
+	return &geocoding.Location{Locality: fmt.Sprintf("%g %g", lat, lng)}
+}
+
+func TestGeocodeRows(t *testing.T) {
+	const n = 1000
+
+	var g stubLocator
+	read := func(rows chan<- *batchRow) error {
+		for i := 0; i < n; i++ {
+			rows <- &batchRow{lat: float64(i), lng: 1, invalid: i%10 == 0}
+		}
+		return nil
+	}
+
+	var i int
+	err := geocodeRows(&g, 8, read, func(r *batchRow) error {
+		if r.lat != float64(i) {
+			t.Fatalf("got row %v at position %d", r.lat, i)
+		}
+		want := fmt.Sprintf("%d 1", i)
+		if r.invalid {
+			want = ""
+		}
+		if r.location.Locality != want {
+			t.Errorf("row %d: got locality %q, want %q", i, r.location.Locality, want)
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != n {
+		t.Errorf("got %d rows written, want %d", i, n)
+	}
+	// invalid rows aren't looked up
+	if g.lookups != n-n/10 {
+		t.Errorf("got %d lookups, want %d", g.lookups, n-n/10)
+	}
+}
+
+func TestGeocodeRowsErrors(t *testing.T) {
+	writeErr := errors.New("write error")
+	readErr := errors.New("read error")
+
+	tests := []struct {
+		name        string
+		readErr     error
+		failAt      int
+		wantErr     error
+		wantWritten int
+	}{
+		{name: "write error", failAt: 10, wantErr: writeErr, wantWritten: 10},
+		{name: "read error", readErr: readErr, failAt: -1, wantErr: readErr, wantWritten: 100},
+		{name: "write error first", readErr: readErr, failAt: 10, wantErr: writeErr, wantWritten: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			read := func(rows chan<- *batchRow) error {
+				for i := 0; i < 100; i++ {
+					rows <- &batchRow{lat: float64(i)}
+				}
+				if tt.readErr != nil {
+					return tt.readErr
+				}
+				// the reader isn't blocked once writing failed
+				for i := 0; i < 10000; i++ {
+					rows <- &batchRow{lat: float64(i)}
+				}
+				return nil
+			}
+
+			var written int
+			err := geocodeRows(&stubLocator{}, 4, read, func(r *batchRow) error {
+				if written == tt.failAt {
+					return writeErr
+				}
+				written++
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if written != tt.wantWritten {
+				t.Errorf("got %d rows written, want %d", written, tt.wantWritten)
+			}
+		})
+	}
+}
+
+func TestBatchCSV(t *testing.T) {
+	empty := strings.Repeat(",", len(locationColumns)-1)
+	location := func(lat, lng string) string {
+		return "," + lat + " " + lng + strings.Repeat(",", len(locationColumns)-2)
+	}
+
+	tests := []struct {
+		name    string
+		opts    batchOptions
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "header",
+			opts: batchOptions{lat: "lat", lng: "lng"},
+			in:   "id,lat,lng\n1,48.5,2.5\n2,north,2.5\n3,100,2.5\n4,1\n5,-41.29,174.78\n",
+			want: "id,lat,lng," + strings.Join(locationColumns, ",") + "\n" +
+				"1,48.5,2.5," + location("48.5", "2.5") + "\n" +
+				"2,north,2.5," + empty + "\n" +
+				"3,100,2.5," + empty + "\n" +
+				"4,1," + empty + "\n" +
+				"5,-41.29,174.78," + location("-41.29", "174.78") + "\n",
+		},
+		{
+			name: "no header",
+			opts: batchOptions{lat: "1", lng: "0", noHeader: true},
+			in:   "2.5,48.5\n",
+			want: "2.5,48.5," + location("48.5", "2.5") + "\n",
+		},
+		{
+			name:    "missing column",
+			opts:    batchOptions{lat: "latitude", lng: "lng"},
+			in:      "id,lat,lng\n1,48.5,2.5\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid column index",
+			opts:    batchOptions{lat: "lat", lng: "1", noHeader: true},
+			in:      "48.5,2.5\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.workers = 4
+			var out bytes.Buffer
+			err := batchCSV(&stubLocator{}, tt.opts, strings.NewReader(tt.in), &out)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchNDJSON(t *testing.T) {
+	location := func(lat, lng string) string {
+		b, err := json.Marshal(&geocoding.Location{Locality: lat + " " + lng})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	tests := []struct {
+		name  string
+		field string
+		in    string
+		want  string
+	}{
+		{
+			name:  "fields order kept",
+			field: "location",
+			in:    `{"z":1,"lat":48.5,"lng":"2.5"}` + "\n" + `  {"lng":2.5,"lat":48.5}  ` + "\n",
+			want: `{"z":1,"lat":48.5,"lng":"2.5","location":` + location("48.5", "2.5") + "}\n" +
+				`{"lng":2.5,"lat":48.5,"location":` + location("48.5", "2.5") + "}\n",
+		},
+		{
+			name:  "existing field replaced",
+			field: "location",
+			in:    `{"location":"Paris","lat":48.5,"lng":2.5,"id":1}`,
+			want:  `{"location":` + location("48.5", "2.5") + `,"lat":48.5,"lng":2.5,"id":1}` + "\n",
+		},
+		{
+			name:  "custom field",
+			field: "place",
+			in:    `{"lat":48.5,"lng":2.5,"location":1}`,
+			want:  `{"lat":48.5,"lng":2.5,"location":1,"place":` + location("48.5", "2.5") + "}\n",
+		},
+		{
+			name:  "invalid rows kept as is",
+			field: "location",
+			in:    "{\"lat\":100,\"lng\":2.5}\n\nnot json\n{\"lat\":48.5}\n[1,2]\n",
+			want:  "{\"lat\":100,\"lng\":2.5}\nnot json\n{\"lat\":48.5}\n[1,2]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := batchOptions{lat: "lat", lng: "lng", field: tt.field, workers: 4}
+			var out bytes.Buffer
+			err := batchNDJSON(&stubLocator{}, opts, strings.NewReader(tt.in), &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), tt.want)
+			}
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				if strings.HasPrefix(line, "{") && !json.Valid([]byte(line)) {
+					t.Errorf("invalid JSON %s", line)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cmdBuildCache updates the repositories and fills the cache, e.g. from a CI
+// job. It fails if a country couldn't be loaded.
+func cmdBuildCache(fs *flag.FlagSet, args []string) {
+	setup(fs, args, 0)
+	mustCheckConfig()
+
+	g := newGeocoder()
+	err := g.UpdateAndLoad()
+	if err != nil {
+		log.WithError(err).Fatal("error building cache")
+	}
+	log.Info("cache built")
+}
+
+// cmdCacheGC removes the cache files whose source file was deleted from the
+// repositories. Countries without a repository are skipped.
+func cmdCacheGC(fs *flag.FlagSet, args []string) {
+	dryRun := fs.Bool("dry-run", false, "only report orphaned cache files")
+	setup(fs, args, 0)
+	mustCheckConfig()
+
+	g := newGeocoder()
+
+	orphans, skipped, err := g.GarbageCollectCache(*dryRun)
+	for _, o := range orphans {
+		fmt.Fprintln(os.Stdout, o)
+	}
+	if len(skipped) > 0 {
+		log.Warnf("skipped countries without a repository: %s", strings.Join(skipped, ", "))
+	}
+	if err != nil {
+		log.WithError(err).Fatal("error collecting cache garbage")
+	}
+
+	if *dryRun {
+		log.Infof("found %d orphaned cache files", len(orphans))
+	} else {
+		log.Infof("removed %d orphaned cache files", len(orphans))
+	}
+}
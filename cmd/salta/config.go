@@ -46,7 +46,6 @@ var allCountries = []string{
 	"bn",
 	"bo",
 	"bq",
-	"bq",
 	"br",
 	"bs",
 	"bt",
@@ -2,15 +2,22 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/Ackar/salta/geocoding"
+	geojson "github.com/paulmach/go.geojson"
 	log "github.com/sirupsen/logrus"
 )
 
 type endpoint struct {
 	geocoder *geocoding.ReverseGeocoder
+
+	shuttingDown int32
 }
 
 func newEndpoint(geocoder *geocoding.ReverseGeocoder) *endpoint {
@@ -19,7 +26,16 @@ func newEndpoint(geocoder *geocoding.ReverseGeocoder) *endpoint {
 	}
 }
 
+// LocationFromLatLong serves the unversioned /location, kept for existing
+// clients. New clients should use /v1/location. It returns 503 while loading,
+// like /readyz, instead of empty locations.
 func (e *endpoint) LocationFromLatLong(w http.ResponseWriter, r *http.Request) {
+	if p := e.geocoder.Progress(); !p.Ready {
+		w.Header().Set("Retry-After", retryAfterLoading(p))
+		http.Error(w, "loading", http.StatusServiceUnavailable)
+		return
+	}
+
 	lat, err := strconv.ParseFloat(r.FormValue("lat"), 64)
 	if err != nil {
 		http.Error(w, "invalid latitude", http.StatusBadRequest)
@@ -31,10 +47,92 @@ func (e *endpoint) LocationFromLatLong(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res := e.geocoder.LocationFromLatLng(lat, lng)
+	var rateErr *rateLimitError
+	if errors.As(takeTokens(r.Context(), 1), &rateErr) {
+		if s := rateErr.retryAfterSeconds(); s != "" {
+			w.Header().Set("Retry-After", s)
+		}
+		http.Error(w, rateErr.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	res := apiKeyFromContext(r.Context()).filterLocation(e.geocoder.LocationFromLatLng(lat, lng))
+
+	if r.FormValue("format") == "geojson" {
+		fc := geojson.NewFeatureCollection()
+		fc.Features = locationFeatures(lat, lng, res, r.FormValue("geometry") == "true")
+		writeGeoJSON(w, fc)
+		return
+	}
 
 	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
 		log.WithError(err).Error("error encoding response")
 	}
 }
+
+func (e *endpoint) Status(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(struct {
+		Countries []geocoding.CountryStatus
+	}{
+		Countries: e.geocoder.Status(),
+	})
+	if err != nil {
+		log.WithError(err).Error("error encoding response")
+	}
+}
+
+// Healthz reports that the process is alive, even while loading.
+func (e *endpoint) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// Readyz reports whether the geocoder is ready to serve requests, along with
+// the loading progress. It returns 503 while loading.
+func (e *endpoint) Readyz(w http.ResponseWriter, r *http.Request) {
+	p := e.geocoder.Progress()
+	ready := p.Ready && atomic.LoadInt32(&e.shuttingDown) == 0
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	err := json.NewEncoder(w).Encode(struct {
+		Ready                     bool
+		CountriesDone             int
+		CountriesTotal            int
+		PolygonsLoaded            int64
+		StartedAt                 time.Time
+		EstimatedRemainingSeconds float64 `json:",omitempty"`
+	}{
+		Ready:                     ready,
+		CountriesDone:             p.CountriesDone,
+		CountriesTotal:            p.CountriesTotal,
+		PolygonsLoaded:            p.PolygonsLoaded,
+		StartedAt:                 p.StartedAt,
+		EstimatedRemainingSeconds: p.EstimatedRemaining.Seconds(),
+	})
+	if err != nil {
+		log.WithError(err).Error("error encoding response")
+	}
+}
+
+// retryAfterLoading returns the Retry-After seconds while loading, from the
+// estimated remaining time when known.
+func retryAfterLoading(p geocoding.Progress) string {
+	const defaultRetry = 10 * time.Second
+
+	d := p.EstimatedRemaining
+	if d <= 0 || d > defaultRetry {
+		// the estimate is rough, clients shouldn't wait too long
+		d = defaultRetry
+	}
+
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func (e *endpoint) setShuttingDown() {
+	atomic.StoreInt32(&e.shuttingDown, 1)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Ackar/salta/geocoding"
+)
+
+func TestLegacyLocationLoading(t *testing.T) {
+	g := testGeocoder()
+	ep := newEndpoint(g)
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ep.LocationFromLatLong(w, httptest.NewRequest("GET", "/location?lat=48.5&lng=2.5", nil))
+		return w
+	}
+
+	w := get()
+	if w.Code != 503 {
+		t.Errorf("got status %d while loading, want %d", w.Code, 503)
+	}
+	if got := w.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("got Retry-After %q while loading, want %q", got, "10")
+	}
+
+	err := g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = get()
+	if w.Code != 200 {
+		t.Fatalf("got status %d once loaded, want %d", w.Code, 200)
+	}
+	var loc geocoding.Location
+	err = json.Unmarshal(w.Body.Bytes(), &loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Locality != "Testville" {
+		t.Errorf("got locality %q, want %q", loc.Locality, "Testville")
+	}
+}
+
+func TestRetryAfterLoading(t *testing.T) {
+	tests := []struct {
+		remaining time.Duration
+		want      string
+	}{
+		{0, "10"},
+		{1500 * time.Millisecond, "2"},
+		{10 * time.Second, "10"},
+		{time.Hour, "10"},
+	}
+	for _, tt := range tests {
+		got := retryAfterLoading(geocoding.Progress{EstimatedRemaining: tt.remaining})
+		if got != tt.want {
+			t.Errorf("retryAfterLoading(%v): got %q, want %q", tt.remaining, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/Ackar/salta/geocoding"
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// geoJSONContentType is the media type of GeoJSON responses.
+const geoJSONContentType = "application/geo+json"
+
+// locationFeatures returns the GeoJSON features of a lookup: the query point,
+// followed by the matched places. The places geometry is their simplified
+// polygons if geometry is set, their bounding box is always included.
+func locationFeatures(lat, lng float64, loc *geocoding.Location, geometry bool) []*geojson.Feature {
+	query := geojson.NewPointFeature([]float64{lng, lat})
+	query.SetProperty("query", true)
+	if loc.Timezone != "" {
+		query.SetProperty("timezone", loc.Timezone)
+		query.SetProperty("utcOffset", loc.UTCOffset)
+	}
+	features := []*geojson.Feature{query}
+
+	places := make([]*geocoding.Place, 0, len(loc.Places))
+	for _, p := range loc.Places {
+		places = append(places, p)
+	}
+	// map order is random, keep the output stable
+	sort.Slice(places, func(i, j int) bool {
+		return placeTypeIndex(places[i].PlaceType) < placeTypeIndex(places[j].PlaceType)
+	})
+
+	for _, p := range places {
+		var f *geojson.Feature
+		if geometry {
+			f = geojson.NewFeature(p.Geometry())
+		} else {
+			f = geojson.NewFeature(nil)
+		}
+		if p.BBox != ([4]float64{}) {
+			f.BoundingBox = p.BBox[:]
+		}
+		if p.ID != 0 {
+			f.ID = p.ID
+			f.SetProperty("id", p.ID)
+		}
+		f.SetProperty("name", p.Name)
+		f.SetProperty("placetype", p.PlaceType)
+		if p.Country != "" {
+			f.SetProperty("country", p.Country)
+		}
+		if p.PlaceType == "locality" && loc.LocalityDistance != nil {
+			f.SetProperty("distance", *loc.LocalityDistance)
+		}
+		features = append(features, f)
+	}
+
+	return features
+}
+
+func placeTypeIndex(placeType string) int {
+	for i, p := range placeTypes {
+		if p == placeType {
+			return i
+		}
+	}
+
+	return len(placeTypes)
+}
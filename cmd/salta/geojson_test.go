@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// getGeoJSON serves a GeoJSON request and decodes its feature collection.
+func getGeoJSON(t *testing.T, api *restAPI, method, target, body string) *geojson.FeatureCollection {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	if w.Code != 200 {
+		t.Fatalf("%s %s: got status %d: %s", method, target, w.Code, w.Body)
+	}
+	fc, err := geojson.UnmarshalFeatureCollection(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("%s %s: invalid feature collection: %v", method, target, err)
+	}
+
+	return fc
+}
+
+func TestLocationFeatures(t *testing.T) {
+	api := newRESTAPI(testLoadedGeocoder(t), nil, nil)
+
+	for _, geometry := range []bool{false, true} {
+		target := "/v1/location?lat=48.5&lng=2.5&format=geojson"
+		if geometry {
+			target += "&geometry=true"
+		}
+		fc := getGeoJSON(t, api, "GET", target, "")
+		if len(fc.Features) != 3 {
+			t.Fatalf("%s: got %d features, want the query point and 2 places", target, len(fc.Features))
+		}
+
+		query := fc.Features[0]
+		if !query.Geometry.IsPoint() || !reflect.DeepEqual(query.Geometry.Point, []float64{2.5, 48.5}) {
+			t.Errorf("%s: got query geometry %+v, want the point [2.5 48.5]", target, query.Geometry)
+		}
+		if q, _ := query.PropertyBool("query"); !q {
+			t.Errorf("%s: query feature without the query property", target)
+		}
+
+		// places by place type, the locality first
+		tests := []struct {
+			id                       float64
+			name, placeType, country string
+			bbox                     []float64
+		}{
+			{id: 1, name: "Testville", placeType: "locality", country: "XX", bbox: []float64{2, 48, 3, 49}},
+			{id: 2, name: "Testregion", placeType: "region", country: "XX", bbox: []float64{1, 47, 4, 50}},
+		}
+		for i, tt := range tests {
+			f := fc.Features[i+1]
+			id, _ := f.PropertyFloat64("id")
+			name, _ := f.PropertyString("name")
+			placeType, _ := f.PropertyString("placetype")
+			country, _ := f.PropertyString("country")
+			if id != tt.id || name != tt.name || placeType != tt.placeType || country != tt.country {
+				t.Errorf("%s: got properties %v, want %+v", target, f.Properties, tt)
+			}
+			if !reflect.DeepEqual(f.BoundingBox, tt.bbox) {
+				t.Errorf("%s: got bbox %v for %s, want %v", target, f.BoundingBox, tt.name, tt.bbox)
+			}
+
+			if !geometry {
+				if f.Geometry != nil {
+					t.Errorf("%s: got geometry %+v for %s without geometry=true", target, f.Geometry, tt.name)
+				}
+				continue
+			}
+			if f.Geometry == nil || !f.Geometry.IsMultiPolygon() || len(f.Geometry.MultiPolygon) != 1 {
+				t.Errorf("%s: got geometry %+v for %s, want a multipolygon", target, f.Geometry, tt.name)
+				continue
+			}
+			// the closed ring of the square polygon, within its bbox
+			ring := f.Geometry.MultiPolygon[0][0]
+			if len(ring) != 5 || !reflect.DeepEqual(ring[0], ring[4]) {
+				t.Errorf("%s: got ring %v for %s, want a closed square", target, ring, tt.name)
+			}
+			for _, p := range ring {
+				if p[0] < tt.bbox[0]-1e-9 || p[0] > tt.bbox[2]+1e-9 || p[1] < tt.bbox[1]-1e-9 || p[1] > tt.bbox[3]+1e-9 {
+					t.Errorf("%s: vertex %v of %s outside of its bbox", target, p, tt.name)
+				}
+			}
+		}
+	}
+}
+
+func TestBatchLocationFeatures(t *testing.T) {
+	api := newRESTAPI(testLoadedGeocoder(t), nil, nil)
+
+	fc := getGeoJSON(t, api, "POST", "/v1/locations?format=geojson", `[{"lat": 10, "lng": 10}, {"lat": 48.5, "lng": 2.5}]`)
+
+	// the query point of each point, followed by its places
+	want := []struct {
+		index int
+		name  string
+	}{
+		{index: 0},
+		{index: 1},
+		{index: 1, name: "Testville"},
+		{index: 1, name: "Testregion"},
+	}
+	if len(fc.Features) != len(want) {
+		t.Fatalf("got %d features, want %d", len(fc.Features), len(want))
+	}
+	for i, w := range want {
+		f := fc.Features[i]
+		index, _ := f.PropertyInt("index")
+		name, _ := f.PropertyString("name")
+		if index != w.index || name != w.name {
+			t.Errorf("feature %d: got index %d and name %q, want %d and %q", i, index, name, w.index, w.name)
+		}
+	}
+}
@@ -1,21 +1,68 @@
 package main
 
 import (
+	"context"
 	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
 
 	"github.com/Ackar/salta/geocoding"
+	graphql "github.com/graph-gophers/graphql-go"
+	log "github.com/sirupsen/logrus"
 )
 
 //go:embed schema.graphql
 var schema string
 
+// graphqlHandler serves the GraphQL API like relay.Handler, but responds with
+// 429 when a resolver hits a rate limit.
+type graphqlHandler struct {
+	schema *graphql.Schema
+}
+
+func (h *graphqlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := h.schema.Exec(r.Context(), params.Query, params.OperationName, params.Variables)
+
+	w.Header().Set("Content-Type", "application/json")
+	for _, e := range response.Errors {
+		var rateErr *rateLimitError
+		if errors.As(e.ResolverError, &rateErr) {
+			if s := rateErr.retryAfterSeconds(); s != "" {
+				w.Header().Set("Retry-After", s)
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+			break
+		}
+	}
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.WithError(err).Error("error encoding response")
+	}
+}
+
 type graphqlResolver struct {
-	geocoder *geocoding.ReverseGeocoder
+	resolver
 }
 
 func newGraphqlResolver(geocoder *geocoding.ReverseGeocoder) *graphqlResolver {
 	return &graphqlResolver{
-		geocoder: geocoder,
+		resolver: resolver{
+			geocoder: geocoder,
+		},
 	}
 }
 
@@ -32,6 +79,23 @@ type location struct {
 	Region        *string
 	MacroRegion   *string
 	Country       *string
+
+	LocalityDistance *float64
+	Timezone         *string
+	UTCOffset        *string
+
+	CampusPlace        *place
+	LocalityPlace      *place
+	MarketAreaPlace    *place
+	NeighbourhoodPlace *place
+	BoroughPlace       *place
+	MicrohoodPlace     *place
+	CountyPlace        *place
+	MacroCountyPlace   *place
+	LocalAdminPlace    *place
+	RegionPlace        *place
+	MacroRegionPlace   *place
+	CountryPlace       *place
 }
 
 type locationFronLatLngInput struct {
@@ -39,14 +103,69 @@ type locationFronLatLngInput struct {
 	Longitude float64
 }
 
-func (r *graphqlResolver) LocationFromLatLng(args struct {
+func (r *graphqlResolver) LocationFromLatLng(ctx context.Context, args struct {
 	Input locationFronLatLngInput
-}) *location {
-	loc := r.geocoder.LocationFromLatLng(args.Input.Latitude, args.Input.Longitude)
-	if loc == nil {
-		return nil
+}) (*location, error) {
+	loc, err := r.locationFromLatLng(ctx, args.Input.Latitude, args.Input.Longitude)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.newLocation(loc), nil
+}
+
+func (r *graphqlResolver) LocationsFromLatLng(ctx context.Context, args struct {
+	Inputs []locationFronLatLngInput
+}) ([]*location, error) {
+	points := make([]latLng, 0, len(args.Inputs))
+	for _, in := range args.Inputs {
+		points = append(points, latLng(in))
+	}
+
+	locs, err := r.locationsFromLatLng(ctx, points)
+	if err != nil {
+		return nil, err
 	}
 
+	res := make([]*location, 0, len(locs))
+	for _, loc := range locs {
+		res = append(res, r.newLocation(loc))
+	}
+
+	return res, nil
+}
+
+func (r *graphqlResolver) Place(ctx context.Context, args struct {
+	ID graphql.ID
+}) (*place, error) {
+	p, err := r.placeByID(ctx, string(args.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.newPlace(p), nil
+}
+
+func (r *graphqlResolver) Places(ctx context.Context, args struct {
+	IDs []graphql.ID
+}) ([]*place, error) {
+	if len(args.IDs) > maxBatchSize {
+		return nil, errBatchTooLarge
+	}
+
+	res := make([]*place, 0, len(args.IDs))
+	for _, id := range args.IDs {
+		p, err := r.placeByID(ctx, string(id))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, r.newPlace(p))
+	}
+
+	return res, nil
+}
+
+func (r *graphqlResolver) newLocation(loc *geocoding.Location) *location {
 	var res location
 	if loc.Campus != "" {
 		res.Campus = &loc.Campus
@@ -84,6 +203,100 @@ func (r *graphqlResolver) LocationFromLatLng(args struct {
 	if loc.Country != "" {
 		res.Country = &loc.Country
 	}
+	res.LocalityDistance = loc.LocalityDistance
+	if loc.Timezone != "" {
+		res.Timezone = &loc.Timezone
+	}
+	if loc.UTCOffset != "" {
+		res.UTCOffset = &loc.UTCOffset
+	}
+
+	res.CampusPlace = r.newPlace(loc.Places["campus"])
+	res.LocalityPlace = r.newPlace(loc.Places["locality"])
+	res.MarketAreaPlace = r.newPlace(loc.Places["marketarea"])
+	res.NeighbourhoodPlace = r.newPlace(loc.Places["neighbourhood"])
+	res.BoroughPlace = r.newPlace(loc.Places["borough"])
+	res.MicrohoodPlace = r.newPlace(loc.Places["microhood"])
+	res.CountyPlace = r.newPlace(loc.Places["county"])
+	res.MacroCountyPlace = r.newPlace(loc.Places["macrocounty"])
+	res.LocalAdminPlace = r.newPlace(loc.Places["localadmin"])
+	res.RegionPlace = r.newPlace(loc.Places["region"])
+	res.MacroRegionPlace = r.newPlace(loc.Places["macroregion"])
+	res.CountryPlace = r.newPlace(loc.Places["country"])
 
 	return &res
 }
+
+// place resolves a Place, its parent is only looked up when requested.
+type place struct {
+	resolver *resolver
+	place    *geocoding.Place
+}
+
+type coordinates struct {
+	Latitude  float64
+	Longitude float64
+}
+
+func (r *graphqlResolver) newPlace(p *geocoding.Place) *place {
+	if p == nil {
+		return nil
+	}
+
+	return &place{
+		resolver: &r.resolver,
+		place:    p,
+	}
+}
+
+func (p *place) ID() *graphql.ID {
+	if p.place.ID == 0 {
+		return nil
+	}
+
+	id := graphql.ID(strconv.FormatInt(p.place.ID, 10))
+	return &id
+}
+
+func (p *place) Name() string {
+	return p.place.Name
+}
+
+func (p *place) Placetype() string {
+	return p.place.PlaceType
+}
+
+func (p *place) CountryCode() *string {
+	if p.place.Country == "" {
+		return nil
+	}
+
+	return &p.place.Country
+}
+
+func (p *place) Centroid() *coordinates {
+	return &coordinates{
+		Latitude:  p.place.Centroid.Latitude,
+		Longitude: p.place.Centroid.Longitude,
+	}
+}
+
+func (p *place) Bbox() []float64 {
+	return p.place.BBox[:]
+}
+
+func (p *place) Parent(ctx context.Context) *place {
+	if p.place.ParentID == 0 {
+		return nil
+	}
+
+	parent := p.resolver.place(ctx, p.place.ParentID)
+	if parent == nil {
+		return nil
+	}
+
+	return &place{
+		resolver: p.resolver,
+		place:    parent,
+	}
+}
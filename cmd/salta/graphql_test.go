@@ -1,6 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 
 	graphql "github.com/graph-gophers/graphql-go"
@@ -10,3 +15,86 @@ func TestResolver(t *testing.T) {
 	// will panic if schema is invalid
 	_ = graphql.MustParseSchema(schema, &graphqlResolver{}, graphql.UseFieldResolvers())
 }
+
+func TestGraphQLQueries(t *testing.T) {
+	s := graphql.MustParseSchema(schema, newGraphqlResolver(testLoadedGeocoder(t)), graphql.UseFieldResolvers())
+
+	tooManyIDs := strings.TrimSuffix(strings.Repeat("1, ", maxBatchSize+1), ", ")
+
+	tests := []struct {
+		name     string
+		query    string
+		wantData string
+		// wantErr is a part of the expected error message
+		wantErr string
+	}{
+		{
+			name:     "place",
+			query:    `{ place(id: 1) { id name placetype countryCode } }`,
+			wantData: `{"place": {"id": "1", "name": "Testville", "placetype": "locality", "countryCode": "XX"}}`,
+		},
+		{
+			name:     "missing place",
+			query:    `{ place(id: 3) { name } }`,
+			wantData: `{"place": null}`,
+		},
+		{
+			name:    "invalid id",
+			query:   `{ place(id: "foo") { name } }`,
+			wantErr: "invalid place id",
+		},
+		{
+			name:     "parent chain",
+			query:    `{ place(id: 1) { name parent { name parent { name } } } }`,
+			wantData: `{"place": {"name": "Testville", "parent": {"name": "Testregion", "parent": null}}}`,
+		},
+		{
+			name:     "places in order",
+			query:    `{ places(ids: [2, 3, 1]) { name } }`,
+			wantData: `{"places": [{"name": "Testregion"}, null, {"name": "Testville"}]}`,
+		},
+		{
+			name:    "too many places",
+			query:   fmt.Sprintf(`{ places(ids: [%s]) { name } }`, tooManyIDs),
+			wantErr: "batch larger than",
+		},
+		{
+			name: "locations in order",
+			query: `{ locationsFromLatLng(inputs: [
+				{latitude: 48.5, longitude: 2.5},
+				{latitude: 10, longitude: 10},
+				{latitude: 48.5, longitude: 2.5}
+			]) { locality regionPlace { id } } }`,
+			wantData: `{"locationsFromLatLng": [
+				{"locality": "Testville", "regionPlace": {"id": "2"}},
+				{"locality": null, "regionPlace": null},
+				{"locality": "Testville", "regionPlace": {"id": "2"}}
+			]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		resp := s.Exec(context.Background(), tt.query, "", nil)
+		if tt.wantErr != "" {
+			if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, tt.wantErr) {
+				t.Errorf("%s: got errors %v, want %q", tt.name, resp.Errors, tt.wantErr)
+			}
+			continue
+		}
+		if len(resp.Errors) > 0 {
+			t.Errorf("%s: got errors %v", tt.name, resp.Errors)
+			continue
+		}
+
+		var got, want bytes.Buffer
+		if err := json.Compact(&got, resp.Data); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Compact(&want, []byte(tt.wantData)); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("%s: got %s, want %s", tt.name, got.String(), want.String())
+		}
+	}
+}
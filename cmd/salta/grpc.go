@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/Ackar/salta/geocoding"
+	"github.com/Ackar/salta/saltapb"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// grpcGeocoder implements the gRPC Geocoder service.
+type grpcGeocoder struct {
+	saltapb.UnimplementedGeocoderServer
+	resolver
+}
+
+func (s *grpcGeocoder) ReverseGeocode(ctx context.Context, req *saltapb.ReverseGeocodeRequest) (*saltapb.Location, error) {
+	loc, err := s.locationFromLatLng(ctx, req.Latitude, req.Longitude)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return newProtoLocation(loc), nil
+}
+
+func (s *grpcGeocoder) ReverseGeocodeStream(stream saltapb.Geocoder_ReverseGeocodeStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		loc, err := s.locationFromLatLng(stream.Context(), req.Latitude, req.Longitude)
+		if err != nil {
+			return grpcError(err)
+		}
+		err = stream.Send(newProtoLocation(loc))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func grpcError(err error) error {
+	if errors.Is(err, errInvalidCoordinates) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	var rateErr *rateLimitError
+	if errors.As(err, &rateErr) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
+func newProtoLocation(loc *geocoding.Location) *saltapb.Location {
+	return &saltapb.Location{
+		Campus:           loc.Campus,
+		Locality:         loc.Locality,
+		MarketArea:       loc.MarketArea,
+		Neighbourhood:    loc.Neighbourhood,
+		Borough:          loc.Borough,
+		Microhood:        loc.Microhood,
+		County:           loc.County,
+		MacroCounty:      loc.MacroCounty,
+		LocalAdmin:       loc.LocalAdmin,
+		Region:           loc.Region,
+		MacroRegion:      loc.MacroRegion,
+		Country:          loc.Country,
+		LocalityDistance: loc.LocalityDistance,
+		Timezone:         loc.Timezone,
+		UtcOffset:        loc.UTCOffset,
+	}
+}
+
+// newGRPCServer returns a gRPC server with the Geocoder, health and
+// reflection services. The health status is NOT_SERVING until the returned
+// health server is resumed.
+func newGRPCServer(g *geocoding.ReverseGeocoder, auth *authenticator, limits *rateLimits) (*grpc.Server, *health.Server) {
+	// authenticate first, the rate limits depend on the key
+	var fns []grpcContextFunc
+	if auth != nil {
+		fns = append(fns, auth.grpcContext)
+	}
+	if limits != nil {
+		fns = append(fns, limits.grpcContext)
+	}
+
+	srv := grpc.NewServer(grpcInterceptors(fns...)...)
+	saltapb.RegisterGeocoderServer(srv, &grpcGeocoder{
+		resolver: resolver{
+			geocoder: g,
+		},
+	})
+
+	hs := health.NewServer()
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	hs.SetServingStatus(saltapb.Geocoder_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+
+	reflection.Register(srv)
+
+	return srv, hs
+}
+
+// grpcContextFunc prepares the context of an RPC, e.g. with its API key, or
+// returns an error to reject it.
+type grpcContextFunc func(ctx context.Context) (context.Context, error)
+
+// grpcInterceptors returns the server options applying fns in order to the
+// Geocoder RPCs. Other services, such as health checking, are left alone.
+func grpcInterceptors(fns ...grpcContextFunc) []grpc.ServerOption {
+	if len(fns) == 0 {
+		return nil
+	}
+
+	prepare := func(ctx context.Context, method string) (context.Context, error) {
+		if !strings.HasPrefix(method, "/"+saltapb.Geocoder_ServiceDesc.ServiceName+"/") {
+			return ctx, nil
+		}
+		for _, fn := range fns {
+			var err error
+			ctx, err = fn(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return ctx, nil
+	}
+
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := prepare(ctx, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := prepare(ss.Context(), info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		}),
+	}
+}
+
+// contextStream is a server stream with a prepared context.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// serveGRPC starts the gRPC server in the background, it exits if the server
+// fails.
+func serveGRPC(srv *grpc.Server) {
+	addr := net.JoinHostPort(viper.GetString("server.address"), strconv.Itoa(viper.GetInt("grpc.port")))
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.WithError(err).Fatal("error listening for gRPC")
+	}
+
+	go func() {
+		log.WithField("address", addr).Info("gRPC listening...")
+		err := srv.Serve(lis)
+		if err != nil {
+			log.WithError(err).Fatal("error running gRPC server")
+		}
+	}()
+}
+
+// shutdownGRPC stops the gRPC server gracefully, waiting for in-flight RPCs
+// until the context is done.
+func shutdownGRPC(ctx context.Context, srv *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		log.Info("gRPC server stopped")
+	case <-ctx.Done():
+		srv.Stop()
+		log.Warn("gRPC server stopped before in-flight RPCs completed")
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/Ackar/salta/geocoding"
+	"github.com/Ackar/salta/saltapb"
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testGeocoder returns a geocoder with the cache of testdata: the locality
+// Testville (1) between 48°N 2°E and 49°N 3°E, in the region Testregion (2)
+// of country XX.
+func testGeocoder() *geocoding.ReverseGeocoder {
+	return geocoding.NewReverseGeocoder("", "testdata/cache", []string{"xx"}, nil)
+}
+
+// testGRPCServer serves g over an in-memory connection, it returns a client
+// connection to it and the health server.
+func testGRPCServer(t *testing.T, g *geocoding.ReverseGeocoder, auth *authenticator, limits *rateLimits) (*grpc.ClientConn, *health.Server) {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv, hs := newGRPCServer(g, auth, limits)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, hs
+}
+
+func TestGRPCReverseGeocode(t *testing.T) {
+	g := testGeocoder()
+	err := g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, _ := testGRPCServer(t, g, nil, nil)
+	client := saltapb.NewGeocoderClient(conn)
+
+	tests := []struct {
+		lat, lng     float64
+		wantLocality string
+		wantCode     codes.Code
+	}{
+		{lat: 48.5, lng: 2.5, wantLocality: "Testville"},
+		{lat: 10, lng: 10, wantLocality: ""},
+		{lat: 100, lng: 2.5, wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		loc, err := client.ReverseGeocode(context.Background(), &saltapb.ReverseGeocodeRequest{Latitude: tt.lat, Longitude: tt.lng})
+		if code := status.Code(err); code != tt.wantCode {
+			t.Errorf("%v,%v: got code %v, want %v", tt.lat, tt.lng, code, tt.wantCode)
+			continue
+		}
+		if err == nil && loc.Locality != tt.wantLocality {
+			t.Errorf("%v,%v: got locality %q, want %q", tt.lat, tt.lng, loc.Locality, tt.wantLocality)
+		}
+	}
+
+	stream, err := client.ReverseGeocodeStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests[:2] {
+		err := stream.Send(&saltapb.ReverseGeocodeRequest{Latitude: tt.lat, Longitude: tt.lng})
+		if err != nil {
+			t.Fatal(err)
+		}
+		loc, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.Locality != tt.wantLocality {
+			t.Errorf("stream %v,%v: got locality %q, want %q", tt.lat, tt.lng, loc.Locality, tt.wantLocality)
+		}
+	}
+	err = stream.CloseSend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("got %v at the end of the stream, want EOF", err)
+	}
+}
+
+func TestGRPCHealth(t *testing.T) {
+	viper.Reset()
+	viper.Set("cache_only", true)
+	defer viper.Reset()
+
+	conn, hs := testGRPCServer(t, testGeocoder(), nil, nil)
+	client := healthpb.NewHealthClient(conn)
+
+	check := func(want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		for _, service := range []string{"", saltapb.Geocoder_ServiceDesc.ServiceName} {
+			resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != want {
+				t.Errorf("service %q: got status %v, want %v", service, resp.Status, want)
+			}
+		}
+	}
+
+	check(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	err := loadAndResume(context.Background(), testGeocoder(), hs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(healthpb.HealthCheckResponse_SERVING)
+}
+
+func TestGRPCHealthLoadFailed(t *testing.T) {
+	viper.Reset()
+	viper.Set("cache_only", true)
+	defer viper.Reset()
+
+	g := geocoding.NewReverseGeocoder("", t.TempDir(), []string{"xx"}, nil)
+	conn, hs := testGRPCServer(t, g, nil, nil)
+
+	err := loadAndResume(context.Background(), g, hs)
+	if err == nil {
+		t.Fatal("no error without a cache")
+	}
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("got status %v, want %v", resp.Status, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+func TestGRPCInterceptors(t *testing.T) {
+	auth := &authenticator{
+		header: "X-API-Key",
+		keys: map[string]*apiKey{
+			"secret":  {Name: "test", Key: "secret"},
+			"limited": {Name: "limited", Key: "limited", Rate: 0.001, Burst: 2},
+		},
+	}
+	limits := &rateLimits{
+		ips:  make(map[string]*ipBucket),
+		keys: make(map[string]*rate.Limiter),
+	}
+	conn, hs := testGRPCServer(t, geocoding.NewReverseGeocoder("", "", nil, nil), auth, limits)
+	client := saltapb.NewGeocoderClient(conn)
+
+	withKey := func(key string) context.Context {
+		if key == "" {
+			return context.Background()
+		}
+		return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+	}
+
+	tests := []struct {
+		key      string
+		wantCode codes.Code
+	}{
+		{key: "", wantCode: codes.Unauthenticated},
+		{key: "wrong", wantCode: codes.Unauthenticated},
+		{key: "secret", wantCode: codes.OK},
+		{key: "secret", wantCode: codes.OK},
+		{key: "secret", wantCode: codes.OK},
+		{key: "limited", wantCode: codes.OK},
+		{key: "limited", wantCode: codes.OK},
+		{key: "limited", wantCode: codes.ResourceExhausted},
+	}
+	for i, tt := range tests {
+		_, err := client.ReverseGeocode(withKey(tt.key), &saltapb.ReverseGeocodeRequest{Latitude: 48.5, Longitude: 2.5})
+		if code := status.Code(err); code != tt.wantCode {
+			t.Errorf("request %d with key %q: got code %v, want %v", i, tt.key, code, tt.wantCode)
+		}
+	}
+
+	// the stream is authenticated when opened
+	stream, err := client.ReverseGeocodeStream(withKey("wrong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("stream: got %v, want code %v", err, codes.Unauthenticated)
+	}
+
+	// health checks don't need a key
+	hs.Resume()
+	_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Errorf("health check: got %v", err)
+	}
+}
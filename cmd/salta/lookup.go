@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cmdLookup prints the location of a point as JSON, loading the data from the
+// cache.
+func cmdLookup(fs *flag.FlagSet, args []string) {
+	args = setup(fs, args, 2)
+	mustCheckConfig()
+
+	lat, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		log.Fatalf("invalid latitude %q", args[0])
+	}
+	lng, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		log.Fatalf("invalid longitude %q", args[1])
+	}
+
+	g := newGeocoder()
+	err = load(context.Background(), g, true)
+	if err != nil {
+		log.WithError(err).Fatal("error loading cache")
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(g.LocationFromLatLng(lat, lng))
+	if err != nil {
+		log.WithError(err).Fatal("error encoding location")
+	}
+}
@@ -1,64 +1,237 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
+	_ "time/tzdata"
 
 	"github.com/Ackar/salta/geocoding"
-	graphql "github.com/graph-gophers/graphql-go"
-	"github.com/graph-gophers/graphql-go/relay"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+// command is a salta subcommand.
+type command struct {
+	name  string
+	args  string
+	short string
+	run   func(fs *flag.FlagSet, args []string)
+}
+
+var commands = []command{
+	{"serve", "", "load the data and start the HTTP server", cmdServe},
+	{"build-cache", "", "update the repositories and fill the cache, then exit", cmdBuildCache},
+	{"lookup", "<lat> <lng>", "print the location of a point, using the cache", cmdLookup},
+	{"stats", "", "print index and cache statistics, using the cache", cmdStats},
+	{"batch", "", "geocode the rows of a CSV or NDJSON file, using the cache", cmdBatch},
+	{"cache gc", "", "remove cache files whose source was deleted", cmdCacheGC},
+	{"config check", "", "validate the config and report all problems", cmdConfigCheck},
+}
+
+// shared flags
+var (
+	configPath string
+	logLevel   string
+)
+
 func main() {
-	if len(os.Args) != 2 {
-		log.Fatal("no config file provided")
+	c, args, ok := findCommand(os.Args[1:])
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	fs := newFlagSet(c)
+	c.run(fs, args)
+}
+
+// findCommand returns the command of the command line args and its arguments,
+// or false if no command matches.
+func findCommand(args []string) (command, []string, bool) {
+	if len(args) == 1 && !isCommand(args[0]) && strings.Contains(args[0], ".") {
+		// salta used to only take the config path
+		log.Warn("salta <config> is deprecated, use salta serve -config <config>")
+		args = []string{"serve", "-config", args[0]}
+	}
+
+	for _, c := range commands {
+		name := strings.Fields(c.name)
+		if len(args) < len(name) || strings.Join(args[:len(name)], " ") != c.name {
+			continue
+		}
+
+		return c, args[len(name):], true
 	}
 
+	return command{}, nil, false
+}
+
+func isCommand(arg string) bool {
+	for _, c := range commands {
+		if strings.Fields(c.name)[0] == arg {
+			return true
+		}
+	}
+
+	return false
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: salta <command> [-config file] [flags] [args]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", c.name, c.short)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun salta <command> -h for the command flags.\n")
+}
+
+// newFlagSet returns the flag set of a command with the shared flags.
+func newFlagSet(c command) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: salta %s [flags] %s\n\n%s\n\nFlags:\n", c.name, c.args, c.short)
+		fs.PrintDefaults()
+	}
+
+	defaultConfig := "config.yaml"
+	if env := os.Getenv("SALTA_CONFIG"); env != "" {
+		defaultConfig = env
+	}
+	fs.StringVar(&configPath, "config", defaultConfig, "config file, also set by $SALTA_CONFIG")
+	fs.StringVar(&logLevel, "log-level", "info", "log level: debug, info, warn or error")
+
+	return fs
+}
+
+// setup parses the command line, sets the log level and reads the config. It
+// returns the positional arguments, exiting if there aren't n of them.
+func setup(fs *flag.FlagSet, args []string, n int) []string {
+	_ = fs.Parse(args)
+	if fs.NArg() != n {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	level, err := log.ParseLevel(logLevel)
+	if err != nil {
+		log.WithError(err).Fatal("invalid log level")
+	}
+	log.SetLevel(level)
+
+	readConfig(configPath)
+
+	return fs.Args()
+}
+
+// load loads the data into the geocoder, from the cache only if cacheOnly is
+// true, until ctx is canceled. Countries failing to load are only logged.
+func load(ctx context.Context, g *geocoding.ReverseGeocoder, cacheOnly bool) error {
+	var err error
+	if cacheOnly {
+		log.Info("using cache only")
+		err = g.LoadCachedFilesContext(ctx)
+	} else {
+		err = g.UpdateAndLoadContext(ctx)
+	}
+	if errors.Is(err, geocoding.ErrCountriesFailed) {
+		log.WithError(err).Warn("some countries failed to load")
+		return nil
+	}
+
+	return err
+}
+
+// readConfig sets the config defaults and reads the given config file.
+func readConfig(path string) {
 	viper.SetDefault("port", 8080)
+	viper.SetDefault("server.address", "")
+	viper.SetDefault("server.read_timeout", "10s")
+	viper.SetDefault("server.write_timeout", "30s")
+	viper.SetDefault("server.idle_timeout", "2m")
+	viper.SetDefault("server.max_header_bytes", http.DefaultMaxHeaderBytes)
+	viper.SetDefault("server.drain_delay", "0s")
+	viper.SetDefault("server.shutdown_timeout", "30s")
+	viper.SetDefault("grpc.port", 0)
+	viper.SetDefault("auth.header", "X-API-Key")
 	viper.SetDefault("repos.folder", "repos")
 	viper.SetDefault("cache.folder", "cache")
 	viper.SetDefault("enabled_place_types", placeTypes)
 	viper.SetDefault("countries", allCountries)
 	viper.SetDefault("cache_only", false)
+	viper.SetDefault("locality_fallback.enabled", false)
+	viper.SetDefault("locality_fallback.max_distance", 10)
+	viper.SetDefault("cell_cache.size", 0)
+	viper.SetDefault("cell_cache.level", 16)
+	viper.SetDefault("coverings.enabled", false)
+	viper.SetDefault("coverings.max_level", 16)
+	viper.SetDefault("coverings.max_cells", 64)
 
-	viper.SetConfigFile(os.Args[1])
+	viper.SetConfigFile(path)
 	if err := viper.ReadInConfig(); err != nil {
 		log.WithError(err).Fatal("error reading config")
 	}
+}
 
-	countries := viper.GetStringSlice("countries")
-	enabledPlaceTypes := viper.GetStringSlice("enabled_place_types")
-	reposFolder := viper.GetString("repos.folder")
-	cacheFolder := viper.GetString("cache.folder")
-	port := viper.GetInt("port")
-	cacheOnly := viper.GetBool("cache_only")
-
-	g := geocoding.NewReverseGeocoder(reposFolder, cacheFolder, countries, enabledPlaceTypes)
+// checkRequiredCountries returns an error if a required country isn't loaded.
+// By default at least one country must be loaded, "*" requires all countries.
+func checkRequiredCountries(g *geocoding.ReverseGeocoder) error {
+	required := viper.GetStringSlice("required_countries")
+	if len(required) == 1 && required[0] == "*" {
+		required = viper.GetStringSlice("countries")
+	}
 
-	if cacheOnly {
-		log.Info("using cache only")
-		err := g.LoadCachedFiles()
-		if err != nil {
-			log.WithError(err).Fatal("error initializing geocoder from cached files")
+	if len(required) == 0 {
+		for _, s := range g.Status() {
+			if g.Loaded(s.Country) {
+				return nil
+			}
 		}
-	} else {
-		err := g.UpdateAndLoad()
-		if err != nil {
-			log.WithError(err).Fatal("error initializing geocoder")
+		return errors.New("no country could be loaded")
+	}
+
+	var missing []string
+	for _, c := range required {
+		if !g.Loaded(c) {
+			missing = append(missing, c)
 		}
 	}
+	if len(missing) > 0 {
+		return fmt.Errorf("required countries not loaded: %s", strings.Join(missing, ", "))
+	}
 
-	r := newGraphqlResolver(g)
-	schema := graphql.MustParseSchema(schema, r, graphql.UseFieldResolvers())
+	return nil
+}
 
-	ep := newEndpoint(g)
+// newGeocoder returns a new geocoder from the config.
+func newGeocoder() *geocoding.ReverseGeocoder {
+	countries := viper.GetStringSlice("countries")
+	enabledPlaceTypes := viper.GetStringSlice("enabled_place_types")
+	reposFolder := viper.GetString("repos.folder")
+	cacheFolder := viper.GetString("cache.folder")
+
+	opts := []geocoding.Option{
+		geocoding.WithWorkers(viper.GetInt("workers")),
+	}
+	if viper.GetBool("locality_fallback.enabled") {
+		opts = append(opts, geocoding.WithLocalityFallback(
+			viper.GetString("locality_fallback.geonames_file"),
+			viper.GetFloat64("locality_fallback.max_distance"),
+		))
+	}
 
-	http.HandleFunc("/location", ep.LocationFromLatLong)
-	http.Handle("/query", &relay.Handler{Schema: schema})
+	if tzFile := viper.GetString("timezones.file"); tzFile != "" {
+		opts = append(opts, geocoding.WithTimezones(tzFile))
+	}
+	if size := viper.GetInt("cell_cache.size"); size > 0 {
+		opts = append(opts, geocoding.WithCellCache(viper.GetInt("cell_cache.level"), size))
+	}
+	if viper.GetBool("coverings.enabled") {
+		opts = append(opts, geocoding.WithCoverings(viper.GetInt("coverings.max_level"), viper.GetInt("coverings.max_cells")))
+	}
 
-	log.WithField("port", port).Info("listening...")
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	return geocoding.NewReverseGeocoder(reposFolder, cacheFolder, countries, enabledPlaceTypes, opts...)
 }
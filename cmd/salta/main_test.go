@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Ackar/salta/geocoding"
+	"github.com/spf13/viper"
+)
+
+func TestCountryLoadFailure(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("countries", []string{"xx", "zz"})
+
+	// zz has no cache
+	g := geocoding.NewReverseGeocoder("", "testdata/cache", []string{"xx", "zz"}, nil)
+	err := g.LoadCachedFiles()
+	if !errors.Is(err, geocoding.ErrCountriesFailed) || !strings.Contains(err.Error(), "zz") {
+		t.Fatalf("got error %v, want %v for zz", err, geocoding.ErrCountriesFailed)
+	}
+	if loc := g.LocationFromLatLng(48.5, 2.5); loc.Locality != "Testville" {
+		t.Errorf("got locality %q, want %q", loc.Locality, "Testville")
+	}
+
+	w := httptest.NewRecorder()
+	newEndpoint(g).Status(w, httptest.NewRequest("GET", "/status", nil))
+	var status struct {
+		Countries []geocoding.CountryStatus
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(map[string]geocoding.CountryStatus)
+	for _, s := range status.Countries {
+		states[s.Country] = s
+	}
+	if s := states["xx"]; s.State != geocoding.LoadStateLoaded || s.Error != "" {
+		t.Errorf("got status %+v for xx, want loaded", s)
+	}
+	if s := states["zz"]; s.State != geocoding.LoadStateFailed || s.Error == "" {
+		t.Errorf("got status %+v for zz, want failed with an error", s)
+	}
+
+	tests := []struct {
+		required []string
+		wantErr  bool
+	}{
+		// at least one country by default
+		{required: nil},
+		{required: []string{"xx"}},
+		{required: []string{"zz"}, wantErr: true},
+		{required: []string{"xx", "zz"}, wantErr: true},
+		{required: []string{"*"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		viper.Set("required_countries", tt.required)
+		err := checkRequiredCountries(g)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("required countries %v: got error %v, want error %v", tt.required, err, tt.wantErr)
+		}
+	}
+
+	// without any loaded country
+	g = geocoding.NewReverseGeocoder("", "testdata/cache", []string{"zz"}, nil)
+	_ = g.LoadCachedFiles()
+	viper.Set("required_countries", nil)
+	if err := checkRequiredCountries(g); err == nil {
+		t.Error("no error without any loaded country")
+	}
+	viper.Set("countries", []string{"xx"})
+	viper.Set("required_countries", []string{"*"})
+	g = testLoadedGeocoder(t)
+	if err := checkRequiredCountries(g); err != nil {
+		t.Errorf("got error %v with all countries loaded", err)
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantName string
+		wantArgs []string
+	}{
+		{nil, "", nil},
+		{[]string{"serve"}, "serve", []string{}},
+		{[]string{"serve", "-config", "prod.yaml"}, "serve", []string{"-config", "prod.yaml"}},
+		{[]string{"lookup", "48.5", "2.5"}, "lookup", []string{"48.5", "2.5"}},
+		{[]string{"cache", "gc", "-config", "prod.yaml"}, "cache gc", []string{"-config", "prod.yaml"}},
+		{[]string{"config", "check"}, "config check", []string{}},
+		{[]string{"cache"}, "", nil},
+		{[]string{"cache", "clear"}, "", nil},
+		{[]string{"unknown"}, "", nil},
+		{[]string{"-config", "prod.yaml"}, "", nil},
+		// deprecated salta <config>
+		{[]string{"prod.yaml"}, "serve", []string{"-config", "prod.yaml"}},
+		{[]string{"prod.yaml", "serve"}, "", nil},
+	}
+	for _, tt := range tests {
+		c, args, ok := findCommand(tt.args)
+		if ok != (tt.wantName != "") || c.name != tt.wantName || !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("findCommand(%q): got %q %q %v, want %q %q", tt.args, c.name, args, ok, tt.wantName, tt.wantArgs)
+		}
+	}
+}
+
+func TestLocalityDistance(t *testing.T) {
+	zero := 0.0
+	tests := []struct {
+		distance *float64
+		wantCSV  string
+	}{
+		{nil, ""},
+		{&zero, "0"},
+	}
+	for _, tt := range tests {
+		loc := &geocoding.Location{Locality: "Testville", LocalityDistance: tt.distance}
+
+		if got := newProtoLocation(loc).LocalityDistance; !reflect.DeepEqual(got, tt.distance) {
+			t.Errorf("%v: got proto distance %v, want %v", tt.distance, got, tt.distance)
+		}
+		if got := newGraphqlResolver(nil).newLocation(loc).LocalityDistance; !reflect.DeepEqual(got, tt.distance) {
+			t.Errorf("%v: got GraphQL distance %v, want %v", tt.distance, got, tt.distance)
+		}
+		values := locationValues(loc)
+		for i, f := range locationColumns {
+			if f == "LocalityDistance" && values[i] != tt.wantCSV {
+				t.Errorf("%v: got CSV distance %q, want %q", tt.distance, values[i], tt.wantCSV)
+			}
+		}
+	}
+}
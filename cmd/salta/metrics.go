@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Ackar/salta/geocoding"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/viper"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "salta_http_requests_total",
+		Help: "Number of HTTP requests by handler and status code.",
+	}, []string{"handler", "code"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "salta_http_request_duration_seconds",
+		Help:    "HTTP request latencies by handler.",
+		Buckets: []float64{.00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"handler"})
+	rateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "salta_rate_limited_total",
+		Help: "Number of requests rejected by the rate limits.",
+	})
+)
+
+// instrument wraps an HTTP handler to record its request count and latency.
+func instrument(name string, h http.Handler) http.Handler {
+	labels := prometheus.Labels{"handler": name}
+	return promhttp.InstrumentHandlerCounter(httpRequests.MustCurryWith(labels),
+		promhttp.InstrumentHandlerDuration(httpDuration.MustCurryWith(labels), h))
+}
+
+// registerMetrics registers the HTTP and geocoder metrics.
+func registerMetrics(g *geocoding.ReverseGeocoder) {
+	prometheus.MustRegister(httpRequests, httpDuration, rateLimited, newGeocoderCollector(g))
+}
+
+// geocoderCollector exports the geocoder statistics.
+type geocoderCollector struct {
+	geocoder *geocoding.ReverseGeocoder
+
+	polygons     *prometheus.Desc
+	loadDuration *prometheus.Desc
+	lastUpdate   *prometheus.Desc
+	cacheHits    *prometheus.Desc
+	cacheMisses  *prometheus.Desc
+	lookups      *prometheus.Desc
+	emptyLookups *prometheus.Desc
+
+	cellCacheHits    *prometheus.Desc
+	cellCacheMisses  *prometheus.Desc
+	cellCacheEntries *prometheus.Desc
+
+	coveringHits      *prometheus.Desc
+	coveringFallbacks *prometheus.Desc
+}
+
+func newGeocoderCollector(g *geocoding.ReverseGeocoder) *geocoderCollector {
+	return &geocoderCollector{
+		geocoder: g,
+
+		polygons: prometheus.NewDesc("salta_index_polygons",
+			"Number of indexed polygons by country and place type.", []string{"country", "placetype"}, nil),
+		loadDuration: prometheus.NewDesc("salta_country_load_duration_seconds",
+			"Time it took to load each country.", []string{"country"}, nil),
+		lastUpdate: prometheus.NewDesc("salta_last_update_timestamp_seconds",
+			"Time the data was last loaded.", nil, nil),
+		cacheHits: prometheus.NewDesc("salta_cache_hits_total",
+			"Number of cache files read instead of processing their source.", nil, nil),
+		cacheMisses: prometheus.NewDesc("salta_cache_misses_total",
+			"Number of source files that had to be processed.", nil, nil),
+		lookups: prometheus.NewDesc("salta_lookups_total",
+			"Number of locations looked up.", nil, nil),
+		emptyLookups: prometheus.NewDesc("salta_lookups_empty_total",
+			"Number of locations looked up without any result.", nil, nil),
+
+		cellCacheHits: prometheus.NewDesc("salta_cell_cache_hits_total",
+			"Number of lookups answered from the cell cache.", nil, nil),
+		cellCacheMisses: prometheus.NewDesc("salta_cell_cache_misses_total",
+			"Number of lookups answered from the index, including those near a boundary.", nil, nil),
+		cellCacheEntries: prometheus.NewDesc("salta_cell_cache_entries",
+			"Number of cells in the cell cache.", nil, nil),
+
+		coveringHits: prometheus.NewDesc("salta_covering_hits_total",
+			"Number of lookups answered from the covering table.", nil, nil),
+		coveringFallbacks: prometheus.NewDesc("salta_covering_fallbacks_total",
+			"Number of lookups near a boundary answered from the index.", nil, nil),
+	}
+}
+
+func (c *geocoderCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.polygons
+	ch <- c.loadDuration
+	ch <- c.lastUpdate
+	ch <- c.cacheHits
+	ch <- c.cacheMisses
+	ch <- c.lookups
+	ch <- c.emptyLookups
+	ch <- c.cellCacheHits
+	ch <- c.cellCacheMisses
+	ch <- c.cellCacheEntries
+	ch <- c.coveringHits
+	ch <- c.coveringFallbacks
+}
+
+func (c *geocoderCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.geocoder.Stats()
+
+	for country, counts := range stats.Polygons {
+		for placeType, n := range counts {
+			ch <- prometheus.MustNewConstMetric(c.polygons, prometheus.GaugeValue, float64(n), country, placeType)
+		}
+	}
+	for country, d := range stats.LoadDurations {
+		ch <- prometheus.MustNewConstMetric(c.loadDuration, prometheus.GaugeValue, d.Seconds(), country)
+	}
+	if !stats.LastUpdate.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.lastUpdate, prometheus.GaugeValue, float64(stats.LastUpdate.Unix()))
+	}
+	ch <- prometheus.MustNewConstMetric(c.cacheHits, prometheus.CounterValue, float64(stats.CacheHits))
+	ch <- prometheus.MustNewConstMetric(c.cacheMisses, prometheus.CounterValue, float64(stats.CacheMisses))
+	ch <- prometheus.MustNewConstMetric(c.lookups, prometheus.CounterValue, float64(stats.Lookups))
+	ch <- prometheus.MustNewConstMetric(c.emptyLookups, prometheus.CounterValue, float64(stats.EmptyLookups))
+	if stats.CellCacheEnabled {
+		ch <- prometheus.MustNewConstMetric(c.cellCacheHits, prometheus.CounterValue, float64(stats.CellCacheHits))
+		ch <- prometheus.MustNewConstMetric(c.cellCacheMisses, prometheus.CounterValue, float64(stats.CellCacheMisses))
+		ch <- prometheus.MustNewConstMetric(c.cellCacheEntries, prometheus.GaugeValue, float64(stats.CellCacheEntries))
+	}
+	if viper.GetBool("coverings.enabled") {
+		ch <- prometheus.MustNewConstMetric(c.coveringHits, prometheus.CounterValue, float64(stats.CoveringHits))
+		ch <- prometheus.MustNewConstMetric(c.coveringFallbacks, prometheus.CounterValue, float64(stats.CoveringFallbacks))
+	}
+}
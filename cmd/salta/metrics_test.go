@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Ackar/salta/geocoding"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCellCacheMetrics(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []geocoding.Option
+		want int
+	}{
+		{name: "disabled"},
+		{name: "enabled", opts: []geocoding.Option{geocoding.WithCellCache(16, 100)}, want: 1},
+		// an invalid level disables the cache
+		{name: "invalid level", opts: []geocoding.Option{geocoding.WithCellCache(31, 100)}},
+	}
+
+	for _, tt := range tests {
+		c := newGeocoderCollector(geocoding.NewReverseGeocoder("", "", nil, nil, tt.opts...))
+		if got := testutil.CollectAndCount(c, "salta_cell_cache_hits_total"); got != tt.want {
+			t.Errorf("%s: got %d cell cache hits metrics, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadMetrics(t *testing.T) {
+	c := newGeocoderCollector(testLoadedGeocoder(t))
+
+	// the cache only load reads the two cache files of testdata
+	want := `
+# HELP salta_cache_hits_total Number of cache files read instead of processing their source.
+# TYPE salta_cache_hits_total counter
+salta_cache_hits_total 2
+# HELP salta_cache_misses_total Number of source files that had to be processed.
+# TYPE salta_cache_misses_total counter
+salta_cache_misses_total 0
+# HELP salta_index_polygons Number of indexed polygons by country and place type.
+# TYPE salta_index_polygons gauge
+salta_index_polygons{country="xx",placetype="locality"} 1
+salta_index_polygons{country="xx",placetype="region"} 1
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(want), "salta_cache_hits_total", "salta_cache_misses_total", "salta_index_polygons")
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, name := range []string{"salta_country_load_duration_seconds", "salta_last_update_timestamp_seconds"} {
+		if got := testutil.CollectAndCount(c, name); got != 1 {
+			t.Errorf("got %d %s metrics, want 1", got, name)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// rateLimitError is returned when a client is over its rate limit.
+type rateLimitError struct {
+	// retryAfter is when the request can be retried, zero if it never can
+	// because it is larger than the bucket.
+	retryAfter time.Duration
+	message    string
+}
+
+func (e *rateLimitError) Error() string {
+	return e.message
+}
+
+// retryAfterSeconds returns the value of the Retry-After header, empty if the
+// request can't be retried.
+func (e *rateLimitError) retryAfterSeconds() string {
+	if e.retryAfter <= 0 {
+		return ""
+	}
+
+	return strconv.Itoa(int(math.Ceil(e.retryAfter.Seconds())))
+}
+
+// rateLimits are the token buckets of the clients, per API key and per IP. A
+// token is taken for each point or place looked up, so that batches count
+// for their size.
+type rateLimits struct {
+	ip       bucketConfig
+	key      bucketConfig
+	ipHeader string
+
+	mu        sync.Mutex
+	ips       map[string]*ipBucket
+	keys      map[string]*rate.Limiter
+	lastSwept time.Time
+}
+
+type bucketConfig struct {
+	rate  rate.Limit
+	burst int
+}
+
+type ipBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimits returns the rate limits of the config and of the API keys, or
+// nil if they are all disabled.
+func newRateLimits(auth *authenticator) *rateLimits {
+	l := &rateLimits{
+		ip:       newBucketConfig(viper.GetFloat64("rate_limit.ip.rate"), viper.GetInt("rate_limit.ip.burst")),
+		key:      newBucketConfig(viper.GetFloat64("rate_limit.key.rate"), viper.GetInt("rate_limit.key.burst")),
+		ipHeader: viper.GetString("rate_limit.ip_header"),
+		ips:      make(map[string]*ipBucket),
+		keys:     make(map[string]*rate.Limiter),
+	}
+	if l.ip.rate == 0 && l.key.rate == 0 && !auth.hasRateLimits() {
+		return nil
+	}
+
+	return l
+}
+
+// newBucketConfig returns a bucket refilled with r tokens per second, the
+// burst defaults to one second worth of tokens.
+func newBucketConfig(r float64, burst int) bucketConfig {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(r)))
+	}
+
+	return bucketConfig{
+		rate:  rate.Limit(r),
+		burst: burst,
+	}
+}
+
+// limiters returns the buckets a request from the given IP and key takes
+// tokens from.
+func (l *rateLimits) limiters(ip string, k *apiKey) []*rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var res []*rate.Limiter
+	if k != nil {
+		lim, ok := l.keys[k.Key]
+		if !ok {
+			conf := l.key
+			if k.Rate > 0 {
+				conf = newBucketConfig(k.Rate, k.Burst)
+			}
+			if conf.rate > 0 {
+				lim = rate.NewLimiter(conf.rate, conf.burst)
+			}
+			l.keys[k.Key] = lim
+		}
+		if lim != nil {
+			res = append(res, lim)
+		}
+	}
+
+	if l.ip.rate > 0 && ip != "" {
+		now := time.Now()
+		l.sweep(now)
+
+		b, ok := l.ips[ip]
+		if !ok {
+			b = &ipBucket{limiter: rate.NewLimiter(l.ip.rate, l.ip.burst)}
+			l.ips[ip] = b
+		}
+		b.lastSeen = now
+		res = append(res, b.limiter)
+	}
+
+	return res
+}
+
+// sweep forgets the IPs whose bucket has been full for a while, it must be
+// called with mu held.
+func (l *rateLimits) sweep(now time.Time) {
+	idle := time.Duration(float64(l.ip.burst) / float64(l.ip.rate) * float64(time.Second))
+	if idle < time.Minute {
+		idle = time.Minute
+	}
+	if now.Sub(l.lastSwept) < idle {
+		return
+	}
+	l.lastSwept = now
+
+	for ip, b := range l.ips {
+		if now.Sub(b.lastSeen) > idle {
+			delete(l.ips, ip)
+		}
+	}
+}
+
+// clientIP returns the IP of an HTTP client, from ipHeader when set, e.g. when
+// behind a load balancer.
+func (l *rateLimits) clientIP(r *http.Request) string {
+	if l.ipHeader != "" {
+		if ip := lastIP(r.Header.Values(l.ipHeader)); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// lastIP returns the last IP of a comma separated list such as
+// X-Forwarded-For, possibly over several header values. It is the one added
+// by the proxy in front of Salta, the previous ones are sent by the client
+// and can't be trusted.
+func lastIP(values []string) string {
+	for i := len(values) - 1; i >= 0; i-- {
+		ips := strings.Split(values[i], ",")
+		if ip := strings.TrimSpace(ips[len(ips)-1]); ip != "" {
+			return ip
+		}
+	}
+
+	return ""
+}
+
+type limitersContextKey struct{}
+
+// wrap returns a handler passing the buckets of the client to h through the
+// request context. It must run after the authentication.
+func (l *rateLimits) wrap(h http.Handler) http.Handler {
+	if l == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lims := l.limiters(l.clientIP(r), apiKeyFromContext(r.Context()))
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), limitersContextKey{}, lims)))
+	})
+}
+
+// grpcContext passes the buckets of the client of an RPC through its context.
+func (l *rateLimits) grpcContext(ctx context.Context) (context.Context, error) {
+	var ip string
+	if l.ipHeader != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		ip = lastIP(md.Get(l.ipHeader))
+	}
+	if p, ok := peer.FromContext(ctx); ok && ip == "" {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+
+	lims := l.limiters(ip, apiKeyFromContext(ctx))
+	return context.WithValue(ctx, limitersContextKey{}, lims), nil
+}
+
+// takeTokens takes n tokens from all the buckets of the context, or none if
+// one of them doesn't have enough.
+func takeTokens(ctx context.Context, n int) error {
+	lims, _ := ctx.Value(limitersContextKey{}).([]*rate.Limiter)
+
+	now := time.Now()
+	reservations := make([]*rate.Reservation, 0, len(lims))
+	cancel := func() {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+
+	for _, lim := range lims {
+		r := lim.ReserveN(now, n)
+		if !r.OK() {
+			cancel()
+			rateLimited.Inc()
+			return &rateLimitError{
+				message: fmt.Sprintf("rate limit exceeded: %d points is more than the burst of %d", n, lim.Burst()),
+			}
+		}
+		reservations = append(reservations, r)
+
+		if d := r.DelayFrom(now); d > 0 {
+			cancel()
+			rateLimited.Inc()
+			return &rateLimitError{
+				retryAfter: d,
+				message:    "rate limit exceeded",
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name     string
+		ipHeader string
+		values   []string
+		want     string
+	}{
+		{name: "no header configured", values: []string{"10.0.0.1"}, want: "192.0.2.1"},
+		{name: "missing header", ipHeader: "X-Forwarded-For", want: "192.0.2.1"},
+		{name: "single IP", ipHeader: "X-Forwarded-For", values: []string{"10.0.0.1"}, want: "10.0.0.1"},
+		// the first IPs are sent by the client
+		{name: "spoofed IPs", ipHeader: "X-Forwarded-For", values: []string{"1.2.3.4, 5.6.7.8, 10.0.0.1"}, want: "10.0.0.1"},
+		{name: "several values", ipHeader: "X-Forwarded-For", values: []string{"1.2.3.4", "10.0.0.1"}, want: "10.0.0.1"},
+		{name: "trailing empty value", ipHeader: "X-Forwarded-For", values: []string{"10.0.0.1", " "}, want: "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		l := &rateLimits{ipHeader: tt.ipHeader}
+		r := httptest.NewRequest("GET", "/v1/location", nil)
+		for _, v := range tt.values {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+
+		if got := l.clientIP(r); got != tt.want {
+			t.Errorf("%s: got IP %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Ackar/salta/geocoding"
+)
+
+// maxBatchSize is the maximum number of points or ids of a batch request.
+const maxBatchSize = 1000
+
+var (
+	// errInvalidCoordinates is returned for coordinates out of range.
+	errInvalidCoordinates = errors.New("invalid coordinates")
+	// errInvalidID is returned for place ids that aren't WOF ids.
+	errInvalidID = errors.New("invalid place id")
+	// errBatchTooLarge is returned for batches over maxBatchSize.
+	errBatchTooLarge = fmt.Errorf("batch larger than %d", maxBatchSize)
+)
+
+// latLng are coordinates to look up.
+type latLng struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// resolver contains the lookup logic shared by the GraphQL and gRPC APIs.
+type resolver struct {
+	geocoder *geocoding.ReverseGeocoder
+}
+
+// locationFromLatLng returns the location of a point, restricted to what the
+// API key of the context gives access to.
+func (r *resolver) locationFromLatLng(ctx context.Context, lat, lng float64) (*geocoding.Location, error) {
+	if !validCoordinates(lat, lng) {
+		return nil, fmt.Errorf("%w: %v, %v", errInvalidCoordinates, lat, lng)
+	}
+	err := takeTokens(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.lookup(ctx, lat, lng)
+}
+
+// lookup returns the location of a point, or the context error once the
+// request is canceled.
+func (r *resolver) lookup(ctx context.Context, lat, lng float64) (*geocoding.Location, error) {
+	loc, err := r.geocoder.LocationFromLatLngContext(ctx, lat, lng)
+	if err != nil {
+		return nil, err
+	}
+
+	return apiKeyFromContext(ctx).filterLocation(loc), nil
+}
+
+// locationsFromLatLng returns the locations of a batch of points, in the same
+// order. The batch fails if any point is invalid, and takes a rate limit token
+// per point.
+func (r *resolver) locationsFromLatLng(ctx context.Context, points []latLng) ([]*geocoding.Location, error) {
+	if len(points) > maxBatchSize {
+		return nil, errBatchTooLarge
+	}
+
+	for i, p := range points {
+		if !validCoordinates(p.Latitude, p.Longitude) {
+			return nil, fmt.Errorf("point %d: %w: %v, %v", i, errInvalidCoordinates, p.Latitude, p.Longitude)
+		}
+	}
+	err := takeTokens(ctx, len(points))
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*geocoding.Location, 0, len(points))
+	for _, p := range points {
+		loc, err := r.lookup(ctx, p.Latitude, p.Longitude)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, loc)
+	}
+
+	return res, nil
+}
+
+// placeByID returns the loaded place with the given WOF id, or nil.
+func (r *resolver) placeByID(ctx context.Context, id string) (*geocoding.Place, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("%w: %q", errInvalidID, id)
+	}
+	err = takeTokens(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.place(ctx, n), nil
+}
+
+// place returns the loaded place with the given WOF id, or nil if there is
+// none or the API key of the context doesn't give access to it.
+func (r *resolver) place(ctx context.Context, id int64) *geocoding.Place {
+	p := r.geocoder.PlaceByID(id)
+	if p == nil || !apiKeyFromContext(ctx).allowsPlace(p) {
+		return nil
+	}
+
+	return p
+}
+
+func validCoordinates(lat, lng float64) bool {
+	// written so that NaNs are invalid
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
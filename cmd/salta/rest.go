@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Ackar/salta/geocoding"
+	geojson "github.com/paulmach/go.geojson"
+	log "github.com/sirupsen/logrus"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// maxBatchBodySize is the maximum size of a batch request body, enough for
+// maxBatchSize points with some whitespace.
+const maxBatchBodySize = maxBatchSize * 256
+
+// errRequestTooLarge is returned for request bodies over their maximum size.
+var errRequestTooLarge = errors.New("request body too large")
+
+// apiError is the body of the REST API error responses.
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// restRoute is a route of the REST API. Its path is the OpenAPI path, where
+// a {param} matches any single segment.
+type restRoute struct {
+	method  string
+	path    string
+	handler http.Handler
+}
+
+// restAPI serves the versioned REST API described by openapi.json.
+type restAPI struct {
+	resolver resolver
+	routes   []restRoute
+}
+
+// newRESTAPI returns the REST API, the lookups require an API key when auth
+// is set and are rate limited when limits is set.
+func newRESTAPI(g *geocoding.ReverseGeocoder, auth *authenticator, limits *rateLimits) *restAPI {
+	a := &restAPI{
+		resolver: resolver{
+			geocoder: g,
+		},
+	}
+	a.routes = []restRoute{
+		{http.MethodGet, "/v1/location", instrument("v1_location", auth.wrap(limits.wrap(http.HandlerFunc(a.location))))},
+		{http.MethodPost, "/v1/locations", instrument("v1_locations", auth.wrap(limits.wrap(http.HandlerFunc(a.locations))))},
+		{http.MethodGet, "/v1/places/{id}", instrument("v1_place", auth.wrap(limits.wrap(http.HandlerFunc(a.place))))},
+		{http.MethodGet, "/v1/openapi.json", http.HandlerFunc(a.openAPI)},
+	}
+
+	return a
+}
+
+func (a *restAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	for _, route := range a.routes {
+		if !matchPath(route.path, r.URL.Path) {
+			continue
+		}
+		if route.method == r.Method {
+			route.handler.ServeHTTP(w, r)
+			return
+		}
+		allowed = append(allowed, route.method)
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	writeError(w, http.StatusNotFound, "not_found", "no such endpoint")
+}
+
+// alias returns a handler serving a path of the API, for the unversioned
+// endpoints kept for existing clients.
+func (a *restAPI) alias(path string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = path
+		a.ServeHTTP(w, r2)
+	})
+}
+
+// matchPath reports whether a request path matches an OpenAPI path.
+func matchPath(pattern, path string) bool {
+	patternParts := strings.Split(pattern, "/")
+	pathParts := strings.Split(path, "/")
+	if len(patternParts) != len(pathParts) {
+		return false
+	}
+
+	for i, p := range patternParts {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			if pathParts[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != pathParts[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a *restAPI) location(w http.ResponseWriter, r *http.Request) {
+	lat, err := strconv.ParseFloat(r.FormValue("lat"), 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid latitude")
+		return
+	}
+	lng, err := strconv.ParseFloat(r.FormValue("lng"), 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid longitude")
+		return
+	}
+
+	loc, err := a.resolver.locationFromLatLng(r.Context(), lat, lng)
+	if err != nil {
+		writeResolverError(w, err)
+		return
+	}
+
+	if r.FormValue("format") == "geojson" {
+		fc := geojson.NewFeatureCollection()
+		fc.Features = locationFeatures(lat, lng, loc, r.FormValue("geometry") == "true")
+		writeGeoJSON(w, fc)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, loc)
+}
+
+// locations looks up a batch of points posted as a JSON array of
+// {"lat": ..., "lng": ...} objects, and returns the locations in the same
+// order.
+func (a *restAPI) locations(w http.ResponseWriter, r *http.Request) {
+	var points []struct {
+		Lat *float64
+		Lng *float64
+	}
+	err := decodeBody(w, r, maxBatchBodySize, &points)
+	if errors.Is(err, errRequestTooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, "request_too_large", fmt.Sprintf("body larger than %d bytes", maxBatchBodySize))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid JSON body")
+		return
+	}
+	batch := make([]latLng, 0, len(points))
+	for i, p := range points {
+		if p.Lat == nil || p.Lng == nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("point %d: missing lat or lng", i))
+			return
+		}
+		batch = append(batch, latLng{Latitude: *p.Lat, Longitude: *p.Lng})
+	}
+
+	res, err := a.resolver.locationsFromLatLng(r.Context(), batch)
+	if err != nil {
+		writeResolverError(w, err)
+		return
+	}
+
+	if r.FormValue("format") == "geojson" {
+		// a single collection, the features of each point are tagged with
+		// its index in the batch
+		geometry := r.FormValue("geometry") == "true"
+		fc := geojson.NewFeatureCollection()
+		for i, loc := range res {
+			for _, f := range locationFeatures(batch[i].Latitude, batch[i].Longitude, loc, geometry) {
+				f.SetProperty("index", i)
+				fc.AddFeature(f)
+			}
+		}
+		writeGeoJSON(w, fc)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// decodeBody decodes a JSON request body of at most limit bytes, the body
+// isn't read further so that a single request can't exhaust the memory.
+func decodeBody(w http.ResponseWriter, r *http.Request, limit int64, v interface{}) error {
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		// the reader fails once limit bytes were read
+		if int64(len(b)) == limit {
+			return errRequestTooLarge
+		}
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func (a *restAPI) place(w http.ResponseWriter, r *http.Request) {
+	p, err := a.resolver.placeByID(r.Context(), strings.TrimPrefix(r.URL.Path, "/v1/places/"))
+	if err != nil {
+		writeResolverError(w, err)
+		return
+	}
+	if p == nil {
+		writeError(w, http.StatusNotFound, "not_found", "place not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (a *restAPI) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPISpec)
+}
+
+// writeResolverError writes the error response of a resolver error.
+func writeResolverError(w http.ResponseWriter, err error) {
+	var rateErr *rateLimitError
+	switch {
+	case errors.As(err, &rateErr):
+		writeRateLimited(w, rateErr)
+	case errors.Is(err, errInvalidCoordinates):
+		writeError(w, http.StatusBadRequest, "invalid_coordinates", err.Error())
+	case errors.Is(err, errInvalidID):
+		writeError(w, http.StatusBadRequest, "invalid_id", err.Error())
+	case errors.Is(err, errBatchTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, "batch_too_large", err.Error())
+	case errors.Is(err, context.Canceled):
+		// the client is gone
+		log.WithError(err).Debug("request canceled")
+	default:
+		log.WithError(err).Error("error serving request")
+		writeError(w, http.StatusInternalServerError, "internal", "internal error")
+	}
+}
+
+func writeRateLimited(w http.ResponseWriter, err *rateLimitError) {
+	if s := err.retryAfterSeconds(); s != "" {
+		w.Header().Set("Retry-After", s)
+	}
+	writeError(w, http.StatusTooManyRequests, "rate_limited", err.Error())
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiError{
+		Code:    code,
+		Message: message,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.WithError(err).Error("error encoding response")
+	}
+}
+
+func writeGeoJSON(w http.ResponseWriter, fc *geojson.FeatureCollection) {
+	w.Header().Set("Content-Type", geoJSONContentType)
+	err := json.NewEncoder(w).Encode(fc)
+	if err != nil {
+		log.WithError(err).Error("error encoding response")
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Ackar/salta/geocoding"
+	"golang.org/x/time/rate"
+)
+
+type openAPIDocument struct {
+	Paths      map[string]map[string]openAPIOperation
+	Components struct {
+		Schemas map[string]openAPISchema
+	}
+}
+
+type openAPIOperation struct {
+	Responses map[string]struct {
+		Content map[string]interface{}
+	}
+}
+
+type openAPISchema struct {
+	Properties map[string]struct {
+		Enum []string
+	}
+}
+
+func loadOpenAPI(t *testing.T) openAPIDocument {
+	t.Helper()
+
+	var doc openAPIDocument
+	err := json.Unmarshal(openAPISpec, &doc)
+	if err != nil {
+		t.Fatalf("invalid openapi.json: %v", err)
+	}
+
+	return doc
+}
+
+func testRESTAPI() *restAPI {
+	return newRESTAPI(geocoding.NewReverseGeocoder("", "", nil, nil), nil, nil)
+}
+
+func TestOpenAPIPaths(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	var documented, served []string
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+	for _, route := range testRESTAPI().routes {
+		served = append(served, route.method+" "+route.path)
+	}
+	sort.Strings(documented)
+	sort.Strings(served)
+
+	if !reflect.DeepEqual(documented, served) {
+		t.Errorf("openapi.json documents %v, the API serves %v", documented, served)
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	tests := []struct {
+		schema string
+		value  interface{}
+	}{
+		{"Location", geocoding.Location{}},
+		{"Place", geocoding.Place{}},
+		{"Coordinates", geocoding.Coordinates{}},
+		{"Error", apiError{}},
+	}
+	for _, tt := range tests {
+		schema, ok := doc.Components.Schemas[tt.schema]
+		if !ok {
+			t.Errorf("schema %s not documented", tt.schema)
+			continue
+		}
+
+		var documented []string
+		for name := range schema.Properties {
+			documented = append(documented, name)
+		}
+		fields := jsonFields(reflect.TypeOf(tt.value))
+		sort.Strings(documented)
+		sort.Strings(fields)
+
+		if !reflect.DeepEqual(documented, fields) {
+			t.Errorf("schema %s documents %v, the JSON fields are %v", tt.schema, documented, fields)
+		}
+	}
+}
+
+// jsonFields returns the names of the JSON encoded fields of a struct.
+func jsonFields(typ reflect.Type) []string {
+	var res []string
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		res = append(res, name)
+	}
+
+	return res
+}
+
+func TestRESTResponses(t *testing.T) {
+	doc := loadOpenAPI(t)
+	api := testRESTAPI()
+
+	errorCodes := doc.Components.Schemas["Error"].Properties["code"].Enum
+
+	tests := []struct {
+		method      string
+		target      string
+		body        string
+		path        string // documented path, empty if undocumented
+		status      int
+		contentType string
+	}{
+		{"GET", "/v1/location?lat=48.85&lng=2.35", "", "/v1/location", 200, "application/json"},
+		{"GET", "/v1/location?lat=48.85&lng=2.35&format=geojson", "", "/v1/location", 200, "application/geo+json"},
+		{"GET", "/v1/location?lat=foo&lng=2.35", "", "/v1/location", 400, "application/json"},
+		{"GET", "/v1/location?lat=100&lng=2.35", "", "/v1/location", 400, "application/json"},
+		{"POST", "/v1/locations", `[{"lat": 48.85, "lng": 2.35}]`, "/v1/locations", 200, "application/json"},
+		{"POST", "/v1/locations?format=geojson", `[{"lat": 48.85, "lng": 2.35}]`, "/v1/locations", 200, "application/geo+json"},
+		{"POST", "/v1/locations", `[{"lat": 48.85}]`, "/v1/locations", 400, "application/json"},
+		{"POST", "/v1/locations", `{`, "/v1/locations", 400, "application/json"},
+		{"POST", "/v1/locations", "[" + strings.Repeat(`{"lat": 0, "lng": 0},`, maxBatchSize) + `{"lat": 0, "lng": 0}]`, "/v1/locations", 413, "application/json"},
+		{"POST", "/v1/locations", "[" + strings.Repeat(" ", maxBatchBodySize) + "]", "/v1/locations", 413, "application/json"},
+		{"GET", "/v1/places/85633147", "", "/v1/places/{id}", 404, "application/json"},
+		{"GET", "/v1/places/foo", "", "/v1/places/{id}", 400, "application/json"},
+		{"GET", "/v1/openapi.json", "", "/v1/openapi.json", 200, "application/json"},
+		{"DELETE", "/v1/location", "", "", 405, "application/json"},
+		{"GET", "/v1/unknown", "", "", 404, "application/json"},
+	}
+	for _, tt := range tests {
+		name := tt.method + " " + tt.target
+		if len(name) > 60 {
+			name = name[:60]
+		}
+
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+
+		if w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d: %s", name, w.Code, tt.status, w.Body)
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%s: got content type %q, want %q", name, ct, tt.contentType)
+		}
+
+		if tt.path != "" {
+			op := doc.Paths[tt.path][strings.ToLower(tt.method)]
+			resp, ok := op.Responses[strconv.Itoa(tt.status)]
+			if !ok {
+				t.Errorf("%s: status %d not documented", name, tt.status)
+			} else if _, ok := resp.Content[tt.contentType]; !ok {
+				t.Errorf("%s: content type %q not documented for status %d", name, tt.contentType, tt.status)
+			}
+		}
+
+		if tt.status >= 400 {
+			var e apiError
+			err := json.Unmarshal(w.Body.Bytes(), &e)
+			if err != nil || e.Message == "" {
+				t.Errorf("%s: invalid error body %q", name, w.Body)
+			} else if !contains(errorCodes, e.Code) {
+				t.Errorf("%s: error code %q not documented", name, e.Code)
+			}
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/v1/location", "/v1/location", true},
+		{"/v1/location", "/v1/location/", false},
+		{"/v1/places/{id}", "/v1/places/85633147", true},
+		{"/v1/places/{id}", "/v1/places/", false},
+		{"/v1/places/{id}", "/v1/places/1/2", false},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRESTAuth(t *testing.T) {
+	auth := &authenticator{
+		header: "X-API-Key",
+		keys: map[string]*apiKey{
+			"secret": {Name: "test", Key: "secret"},
+		},
+	}
+	api := newRESTAPI(geocoding.NewReverseGeocoder("", "", nil, nil), auth, nil)
+
+	tests := []struct {
+		target string
+		key    string
+		status int
+	}{
+		{"/v1/location?lat=48.85&lng=2.35", "", 401},
+		{"/v1/location?lat=48.85&lng=2.35", "wrong", 401},
+		{"/v1/location?lat=48.85&lng=2.35", "secret", 200},
+		{"/v1/openapi.json", "", 200},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		if tt.key != "" {
+			r.Header.Set("X-API-Key", tt.key)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s with key %q: got status %d, want %d", tt.target, tt.key, w.Code, tt.status)
+		}
+	}
+}
+
+func TestRESTRateLimit(t *testing.T) {
+	limits := &rateLimits{
+		ip:   newBucketConfig(0.001, 2),
+		ips:  make(map[string]*ipBucket),
+		keys: make(map[string]*rate.Limiter),
+	}
+	api := newRESTAPI(geocoding.NewReverseGeocoder("", "", nil, nil), nil, limits)
+
+	tests := []struct {
+		points     int
+		status     int
+		retryAfter bool
+	}{
+		{3, 429, false}, // larger than the burst
+		{2, 200, false},
+		{1, 429, true},
+	}
+	for i, tt := range tests {
+		body := "[" + strings.TrimSuffix(strings.Repeat(`{"lat": 0, "lng": 0},`, tt.points), ",") + "]"
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest("POST", "/v1/locations", strings.NewReader(body)))
+
+		if w.Code != tt.status {
+			t.Errorf("request %d: got status %d, want %d", i, w.Code, tt.status)
+		}
+		if got := w.Header().Get("Retry-After") != ""; got != tt.retryAfter {
+			t.Errorf("request %d: got Retry-After %q", i, w.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestRESTAlias(t *testing.T) {
+	auth := &authenticator{
+		header: "X-API-Key",
+		keys: map[string]*apiKey{
+			"secret": {Name: "test", Key: "secret"},
+		},
+	}
+	alias := newRESTAPI(geocoding.NewReverseGeocoder("", "", nil, nil), auth, nil).alias("/v1/locations")
+
+	tests := []struct {
+		method string
+		body   string
+		key    string
+		status int
+	}{
+		{"POST", `[{"lat": 48.85, "lng": 2.35}]`, "secret", 200},
+		{"POST", `[{"lat": 48.85}]`, "secret", 400},
+		{"POST", `[{"lat": 48.85, "lng": 2.35}]`, "", 401},
+		{"GET", "", "secret", 405},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/locations", strings.NewReader(tt.body))
+		if tt.key != "" {
+			r.Header.Set("X-API-Key", tt.key)
+		}
+		w := httptest.NewRecorder()
+		alias.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s with key %q: got status %d, want %d", tt.method, tt.body, tt.key, w.Code, tt.status)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s: got content type %q", tt.method, tt.body, ct)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Ackar/salta/geocoding"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+)
+
+// cmdServe loads the data and serves the HTTP API until SIGTERM.
+func cmdServe(fs *flag.FlagSet, args []string) {
+	setup(fs, args, 0)
+	mustCheckConfig()
+
+	g := newGeocoder()
+
+	auth, err := newAuthenticator()
+	if err != nil {
+		log.WithError(err).Fatal("error loading API keys")
+	}
+	limits := newRateLimits(auth)
+
+	r := newGraphqlResolver(g)
+	schema := graphql.MustParseSchema(schema, r, graphql.UseFieldResolvers())
+
+	ep := newEndpoint(g)
+
+	registerMetrics(g)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	mux := http.NewServeMux()
+	mux.Handle("/location", instrument("location", auth.wrap(limits.wrap(http.HandlerFunc(ep.LocationFromLatLong)))))
+	rest := newRESTAPI(g, auth, limits)
+	mux.Handle("/v1/", rest)
+	mux.Handle("/locations", rest.alias("/v1/locations"))
+	mux.Handle("/status", instrument("status", http.HandlerFunc(ep.Status)))
+	mux.HandleFunc("/healthz", ep.Healthz)
+	mux.HandleFunc("/readyz", ep.Readyz)
+	mux.Handle("/query", instrument("query", auth.wrap(limits.wrap(&graphqlHandler{schema: schema}))))
+	mux.Handle("/metrics", promhttp.Handler())
+	if token := viper.GetString("admin.token"); token != "" {
+		admin := instrument("admin", newAdminHandler(ctx, g, token))
+		mux.Handle("/admin/countries", admin)
+		mux.Handle("/admin/countries/", admin)
+	}
+
+	// start listening right away so that orchestrators can follow the loading
+	srv := newServer(mux)
+	serve(srv)
+
+	var grpcSrv *grpc.Server
+	var grpcHealth *health.Server
+	if viper.GetInt("grpc.port") != 0 {
+		grpcSrv, grpcHealth = newGRPCServer(g, auth, limits)
+		serveGRPC(grpcSrv)
+	}
+
+	go func() {
+		err := loadAndResume(ctx, g, grpcHealth)
+		if ctx.Err() != nil {
+			// shutting down
+			return
+		}
+		if err != nil {
+			log.WithError(err).Fatal("error initializing geocoder")
+		}
+		log.Info("geocoder ready")
+	}()
+
+	gracefulShutdown(ctx, ep, srv, grpcSrv, grpcHealth)
+}
+
+// newServer returns an HTTP server configured from the config.
+func newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:           net.JoinHostPort(viper.GetString("server.address"), strconv.Itoa(viper.GetInt("port"))),
+		Handler:        handler,
+		ReadTimeout:    viper.GetDuration("server.read_timeout"),
+		WriteTimeout:   viper.GetDuration("server.write_timeout"),
+		IdleTimeout:    viper.GetDuration("server.idle_timeout"),
+		MaxHeaderBytes: viper.GetInt("server.max_header_bytes"),
+	}
+}
+
+// serve starts the server in the background, it exits if the server fails.
+func serve(srv *http.Server) {
+	go func() {
+		log.WithField("address", srv.Addr).Info("listening...")
+		err := srv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Fatal("error running server")
+		}
+	}()
+}
+
+// gracefulShutdown waits until ctx is done, then stops advertising readiness
+// and keeps accepting requests for the drain delay so that load balancers
+// notice. The servers are then stopped, waiting for in-flight requests until
+// the shutdown timeout. grpcSrv and grpcHealth may be nil.
+func gracefulShutdown(ctx context.Context, ep *endpoint, srv *http.Server, grpcSrv *grpc.Server, grpcHealth *health.Server) {
+	<-ctx.Done()
+
+	ep.setShuttingDown()
+	if grpcHealth != nil {
+		grpcHealth.Shutdown()
+	}
+	if delay := viper.GetDuration("server.drain_delay"); delay > 0 {
+		log.WithField("delay", delay).Info("draining...")
+		time.Sleep(delay)
+	}
+
+	timeout := viper.GetDuration("server.shutdown_timeout")
+	log.WithField("timeout", timeout).Info("shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	if grpcSrv != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shutdownGRPC(ctx, grpcSrv)
+		}()
+	}
+	shutdown(ctx, srv)
+	wg.Wait()
+}
+
+// loadAndResume loads the data and checks the required countries, then sets
+// the gRPC health status to SERVING. The status is left untouched on error.
+func loadAndResume(ctx context.Context, g *geocoding.ReverseGeocoder, grpcHealth *health.Server) error {
+	err := load(ctx, g, viper.GetBool("cache_only"))
+	if err != nil {
+		return err
+	}
+	err = checkRequiredCountries(g)
+	if err != nil {
+		return err
+	}
+	if grpcHealth != nil {
+		grpcHealth.Resume()
+	}
+
+	return nil
+}
+
+// shutdown stops the server gracefully, waiting for in-flight requests until
+// the context is done.
+func shutdown(ctx context.Context, srv *http.Server) {
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		log.WithError(err).Error("error shutting down server")
+		return
+	}
+	log.Info("server stopped")
+}
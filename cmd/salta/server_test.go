@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Ackar/salta/saltapb"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	const drainDelay = 200 * time.Millisecond
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("server.drain_delay", drainDelay)
+	viper.Set("server.shutdown_timeout", 5*time.Second)
+
+	g := testLoadedGeocoder(t)
+	ep := newEndpoint(g)
+
+	// an HTTP request in flight until released
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", ep.Readyz)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = w.Write([]byte("done"))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	lis := bufconn.Listen(1 << 20)
+	grpcSrv, grpcHealth := newGRPCServer(g, nil, nil)
+	grpcHealth.Resume()
+	go grpcSrv.Serve(lis)
+	defer grpcSrv.Stop()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// a gRPC stream in flight
+	stream, err := saltapb.NewGeocoderClient(conn).ReverseGeocodeStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	geocode := func() {
+		t.Helper()
+		err := stream.Send(&saltapb.ReverseGeocodeRequest{Latitude: 48.5, Longitude: 2.5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		loc, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.Locality != "Testville" {
+			t.Errorf("got locality %q, want %q", loc.Locality, "Testville")
+		}
+	}
+	geocode()
+
+	slow := make(chan string)
+	go func() {
+		resp, err := http.Get(ts.URL + "/slow")
+		if err != nil {
+			t.Error(err)
+			close(slow)
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		slow <- string(b)
+	}()
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		gracefulShutdown(ctx, ep, ts.Config, grpcSrv, grpcHealth)
+		close(stopped)
+	}()
+	cancel()
+
+	// while draining, new requests are served but readiness is reported false
+	time.Sleep(drainDelay / 4)
+	resp, err := http.Get(ts.URL + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got readiness status %d while draining, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	health, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("got gRPC health %v while draining, want %v", health.Status, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+
+	// the servers wait for the requests in flight
+	time.Sleep(drainDelay)
+	select {
+	case <-stopped:
+		t.Fatal("servers stopped with requests in flight")
+	default:
+	}
+	close(release)
+	if body := <-slow; body != "done" {
+		t.Errorf("got body %q for the request in flight, want %q", body, "done")
+	}
+	geocode()
+	err = stream.CloseSend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("got %v at the end of the stream, want EOF", err)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("servers not stopped")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Ackar/salta/geocoding"
+	log "github.com/sirupsen/logrus"
+)
+
+// cmdStats loads the data from the cache and prints the index and cache
+// statistics of each country.
+func cmdStats(fs *flag.FlagSet, args []string) {
+	asJSON := fs.Bool("json", false, "print the statistics as JSON")
+	setup(fs, args, 0)
+	mustCheckConfig()
+
+	g := newGeocoder()
+	err := load(context.Background(), g, true)
+	if err != nil {
+		log.WithError(err).Fatal("error loading cache")
+	}
+
+	caches, err := g.CacheStats()
+	if err != nil {
+		log.WithError(err).Fatal("error reading cache statistics")
+	}
+	stats := g.Stats()
+	status := g.Status()
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(struct {
+			Index     geocoding.Stats
+			Countries []geocoding.CountryStatus
+			Cache     []geocoding.CountryCache
+		}{
+			Index:     stats,
+			Countries: status,
+			Cache:     caches,
+		})
+		if err != nil {
+			log.WithError(err).Fatal("error encoding statistics")
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COUNTRY\tSTATE\tPOLYGONS\tLOAD TIME\tCACHE FILES\tCACHE SIZE\tCACHE UP-TO-DATE\tCOMMIT")
+	var polygons, files int
+	var bytes int64
+	for i, s := range status {
+		var n int
+		for _, count := range stats.Polygons[s.Country] {
+			n += count
+		}
+		c := caches[i]
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s\t%t\t%s\n", s.Country, s.State, n,
+			stats.LoadDurations[s.Country].Round(time.Millisecond), c.Files, formatBytes(c.Bytes), c.UpToDate, c.Commit)
+
+		polygons += n
+		files += c.Files
+		bytes += c.Bytes
+	}
+	fmt.Fprintf(w, "total\t\t%d\t\t%d\t%s\t\t\n", polygons, files, formatBytes(bytes))
+	w.Flush()
+}
+
+// formatBytes returns a human readable size.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// countryAliases are common mistakes for country codes.
+var countryAliases = map[string]string{
+	"uk": "gb",
+	"el": "gr",
+}
+
+// checkConfig validates the config and returns all the problems found.
+func checkConfig() []string {
+	var problems []string
+
+	countries := viper.GetStringSlice("countries")
+	problems = append(problems, checkValues("countries", countries, allCountries, suggestCountry)...)
+	problems = append(problems, checkValues("enabled_place_types", viper.GetStringSlice("enabled_place_types"), placeTypes, suggestPlaceType)...)
+
+	required := viper.GetStringSlice("required_countries")
+	if !(len(required) == 1 && required[0] == "*") {
+		for _, c := range required {
+			if !contains(countries, c) {
+				problems = append(problems, fmt.Sprintf("required_countries: %q is not in countries", c))
+			}
+		}
+	}
+
+	if port := viper.GetInt("port"); port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("port: %d is not a valid port", port))
+	}
+	if port := viper.GetInt("grpc.port"); port < 0 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("grpc.port: %d is not a valid port", port))
+	} else if port == viper.GetInt("port") {
+		problems = append(problems, "grpc.port: must be different from port")
+	}
+	if size := viper.GetInt("cell_cache.size"); size < 0 {
+		problems = append(problems, fmt.Sprintf("cell_cache.size: must not be negative, got %d", size))
+	}
+	if level := viper.GetInt("cell_cache.level"); level < 0 || level > 30 {
+		problems = append(problems, fmt.Sprintf("cell_cache.level: must be between 0 and 30, got %d", level))
+	}
+	if viper.GetBool("coverings.enabled") {
+		if level := viper.GetInt("coverings.max_level"); level < 0 || level > 30 {
+			problems = append(problems, fmt.Sprintf("coverings.max_level: must be between 0 and 30, got %d", level))
+		}
+		if cells := viper.GetInt("coverings.max_cells"); cells <= 0 {
+			problems = append(problems, fmt.Sprintf("coverings.max_cells: must be positive, got %d", cells))
+		}
+	}
+	if workers := viper.GetInt("workers"); workers < 0 {
+		problems = append(problems, fmt.Sprintf("workers: must not be negative, got %d", workers))
+	}
+
+	if viper.GetBool("locality_fallback.enabled") {
+		if d := viper.GetFloat64("locality_fallback.max_distance"); d <= 0 {
+			problems = append(problems, fmt.Sprintf("locality_fallback.max_distance: must be positive, got %v", d))
+		}
+		if !contains(viper.GetStringSlice("enabled_place_types"), "locality") {
+			problems = append(problems, "locality_fallback: the locality place type is not enabled")
+		}
+		problems = append(problems, checkFile("locality_fallback.geonames_file")...)
+	}
+	problems = append(problems, checkFile("timezones.file")...)
+	problems = append(problems, checkAPIKeys()...)
+	for _, key := range []string{"rate_limit.ip", "rate_limit.key"} {
+		if r := viper.GetFloat64(key + ".rate"); r < 0 {
+			problems = append(problems, fmt.Sprintf("%s.rate: must not be negative, got %v", key, r))
+		}
+		if b := viper.GetInt(key + ".burst"); b < 0 {
+			problems = append(problems, fmt.Sprintf("%s.burst: must not be negative, got %d", key, b))
+		}
+	}
+
+	return problems
+}
+
+// mustCheckConfig exits if the config is invalid.
+func mustCheckConfig() {
+	problems := checkConfig()
+	for _, p := range problems {
+		log.Error(p)
+	}
+	if len(problems) > 0 {
+		log.Fatalf("invalid config: %d problems found, see `salta config check`", len(problems))
+	}
+}
+
+// cmdConfigCheck validates the config and prints its problems.
+func cmdConfigCheck(fs *flag.FlagSet, args []string) {
+	setup(fs, args, 0)
+
+	problems := checkConfig()
+	if len(problems) == 0 {
+		fmt.Println("config OK")
+		return
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	os.Exit(1)
+}
+
+// checkValues checks that values are known and not duplicated.
+func checkValues(key string, values, known []string, suggest func(string) string) []string {
+	var problems []string
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		if seen[v] {
+			problems = append(problems, fmt.Sprintf("%s: %q is listed more than once", key, v))
+			continue
+		}
+		seen[v] = true
+
+		if contains(known, v) {
+			continue
+		}
+		p := fmt.Sprintf("%s: unknown value %q", key, v)
+		if s := suggest(v); s != "" {
+			p += fmt.Sprintf(", did you mean %q?", s)
+		}
+		problems = append(problems, p)
+	}
+
+	return problems
+}
+
+// checkAPIKeys checks that the API keys are set, unique, and that their
+// restrictions are valid.
+func checkAPIKeys() []string {
+	keys, err := loadAPIKeys()
+	if err != nil {
+		return []string{fmt.Sprintf("auth: %v", err)}
+	}
+
+	var problems []string
+	seen := make(map[string]bool, len(keys))
+	for i, k := range keys {
+		name := k.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		prefix := fmt.Sprintf("auth.keys[%s]", name)
+
+		switch {
+		case k.Key == "":
+			problems = append(problems, prefix+": the key is empty")
+		case seen[k.Key]:
+			problems = append(problems, prefix+": the key is used more than once")
+		}
+		seen[k.Key] = true
+
+		problems = append(problems, checkValues(prefix+".countries", k.Countries, allCountries, suggestCountry)...)
+		problems = append(problems, checkValues(prefix+".place_types", k.PlaceTypes, placeTypes, suggestPlaceType)...)
+		if k.Rate < 0 || k.Burst < 0 {
+			problems = append(problems, prefix+": rate and burst must not be negative")
+		}
+	}
+	if len(keys) > 0 && viper.GetString("auth.header") == "" {
+		problems = append(problems, "auth.header: must not be empty")
+	}
+
+	return problems
+}
+
+// checkFile checks that the file set by a config key exists, if any.
+func checkFile(key string) []string {
+	path := viper.GetString(key)
+	if path == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return []string{fmt.Sprintf("%s: %v", key, err)}
+	}
+
+	return nil
+}
+
+func suggestCountry(country string) string {
+	country = strings.ToLower(country)
+	if alias, ok := countryAliases[country]; ok {
+		return alias
+	}
+	if contains(allCountries, country) {
+		return country
+	}
+
+	// two letter codes are too close to each other for edit distance
+	// suggestions to be useful
+	return ""
+}
+
+func suggestPlaceType(placeType string) string {
+	placeType = strings.ToLower(placeType)
+
+	var best string
+	bestDistance := 3 // suggestions further away are unlikely to be right
+	for _, p := range placeTypes {
+		if d := levenshtein(placeType, p); d < bestDistance {
+			best = p
+			bestDistance = d
+		}
+	}
+
+	return best
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	res := values[0]
+	for _, v := range values[1:] {
+		if v < res {
+			res = v
+		}
+	}
+
+	return res
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
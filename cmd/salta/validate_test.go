@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "", b: "abc", want: 3},
+		{a: "abc", b: "", want: 3},
+		{a: "locality", b: "locality", want: 0},
+		{a: "neigbourhood", b: "neighbourhood", want: 1},
+		{a: "neighborhood", b: "neighbourhood", want: 1},
+		{a: "kitten", b: "sitting", want: 3},
+	}
+
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	tests := []struct {
+		suggest func(string) string
+		value   string
+		want    string
+	}{
+		{suggest: suggestPlaceType, value: "neigbourhood", want: "neighbourhood"},
+		{suggest: suggestPlaceType, value: "neighborhood", want: "neighbourhood"},
+		{suggest: suggestPlaceType, value: "Locality", want: "locality"},
+		{suggest: suggestPlaceType, value: "city", want: ""},
+		{suggest: suggestCountry, value: "uk", want: "gb"},
+		{suggest: suggestCountry, value: "UK", want: "gb"},
+		{suggest: suggestCountry, value: "FR", want: "fr"},
+		{suggest: suggestCountry, value: "zz", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := tt.suggest(tt.value); got != tt.want {
+			t.Errorf("%q: got suggestion %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name:   "defaults",
+			config: "",
+		},
+		{
+			name:   "valid",
+			config: "countries: [fr, gb]\nrequired_countries: [fr]\nenabled_place_types: [locality, region]\n",
+		},
+		{
+			name: "several problems",
+			config: "countries: [fr, uk, fr]\n" +
+				"required_countries: [de]\n" +
+				"enabled_place_types: [neigbourhood, locality]\n" +
+				"port: 70000\n",
+			want: []string{
+				`countries: unknown value "uk", did you mean "gb"?`,
+				`countries: "fr" is listed more than once`,
+				`enabled_place_types: unknown value "neigbourhood", did you mean "neighbourhood"?`,
+				`required_countries: "de" is not in countries`,
+				`port: 70000 is not a valid port`,
+			},
+		},
+		{
+			name:   "locality fallback",
+			config: "locality_fallback:\n  enabled: true\n  max_distance: 0\nenabled_place_types: [region]\n",
+			want: []string{
+				"locality_fallback.max_distance: must be positive, got 0",
+				"locality_fallback: the locality place type is not enabled",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			err := os.WriteFile(path, []byte(tt.config), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			viper.Reset()
+			defer viper.Reset()
+			readConfig(path)
+
+			if got := checkConfig(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got problems %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
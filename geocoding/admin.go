@@ -0,0 +1,262 @@
+package geocoding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/geo/s2"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrUnknownCountry is returned when unloading a country that isn't loaded.
+var ErrUnknownCountry = errors.New("unknown country")
+
+var countryCodeRegexp = regexp.MustCompile(`^[a-z]{2}$`)
+
+// LoadCountry updates, indexes and adds a country to the live index, queries
+// are served meanwhile. Loading a country that is already loaded reloads it:
+// its previous data is served until the new one is indexed, and is kept if
+// the reload fails.
+func (g *ReverseGeocoder) LoadCountry(country string) error {
+	return g.LoadCountryContext(context.Background(), country)
+}
+
+// LoadCountryContext is like LoadCountry. If ctx is canceled the load is
+// stopped and fails, the previous data of the country keeps being served.
+func (g *ReverseGeocoder) LoadCountryContext(ctx context.Context, country string) error {
+	if !countryCodeRegexp.MatchString(country) {
+		return fmt.Errorf("invalid country code %q", country)
+	}
+
+	g.addCountry(country)
+
+	g.loadMu.Lock()
+	defer g.loadMu.Unlock()
+
+	g.startLoading([]string{country})
+
+	g.shapesMu.Lock()
+	previous := g.shapes[country]
+	delete(g.shapes, country)
+	g.shapesMu.Unlock()
+
+	start := time.Now()
+	state, err := g.loadCountry(ctx, country)
+	if state != LoadStateFailed {
+		geoNamesErr := g.loadLocalityFallback([]string{country})
+		if geoNamesErr != nil {
+			log.WithError(geoNamesErr).WithField("country", country).Error("error loading locality fallback")
+		}
+	}
+	g.setLoadDuration(country, time.Since(start))
+
+	if state == LoadStateFailed {
+		// the indexes still serve the previous data, drop the partially
+		// loaded shapes
+		g.shapesMu.Lock()
+		g.shapes[country] = previous
+		g.shapesMu.Unlock()
+		if len(previous) > 0 {
+			state = LoadStateStale
+		}
+	} else {
+		g.rebuildIndexes()
+	}
+	g.recountPolygons(country)
+	g.setStatus(country, state, err)
+
+	if err != nil {
+		return fmt.Errorf("error loading %q: %w", country, err)
+	}
+	log.WithField("country", country).Info("country loaded")
+
+	return nil
+}
+
+// UnloadCountry removes a country and its shapes from the index. Its
+// repository and cache are kept so that loading it again is fast.
+func (g *ReverseGeocoder) UnloadCountry(country string) error {
+	g.loadMu.Lock()
+	defer g.loadMu.Unlock()
+
+	if !g.removeCountry(country) {
+		return fmt.Errorf("%w: %q", ErrUnknownCountry, country)
+	}
+
+	g.shapesMu.Lock()
+	delete(g.shapes, country)
+	g.shapesMu.Unlock()
+	g.rebuildIndexes()
+
+	g.statsMu.Lock()
+	delete(g.polygonCounts, country)
+	delete(g.loadDurations, country)
+	g.statsMu.Unlock()
+
+	log.WithField("country", country).Info("country unloaded")
+
+	return nil
+}
+
+// LoadedCountries returns the countries whose data is currently served.
+func (g *ReverseGeocoder) LoadedCountries() []string {
+	status := g.Status()
+	res := make([]string, 0, len(status))
+	for _, s := range status {
+		if s.State == LoadStateLoaded || s.State == LoadStateStale {
+			res = append(res, s.Country)
+		}
+	}
+
+	return res
+}
+
+// countriesList returns a copy of the countries.
+func (g *ReverseGeocoder) countriesList() []string {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	return append([]string(nil), g.countries...)
+}
+
+// addCountry adds a country to the countries if it is not already there.
+func (g *ReverseGeocoder) addCountry(country string) {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	for _, c := range g.countries {
+		if c == country {
+			return
+		}
+	}
+	g.countries = append(g.countries, country)
+}
+
+// removeCountry removes a country from the countries along with its status,
+// it returns false if the country wasn't there.
+func (g *ReverseGeocoder) removeCountry(country string) bool {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	for i, c := range g.countries {
+		if c == country {
+			g.countries = append(g.countries[:i:i], g.countries[i+1:]...)
+			delete(g.status, country)
+			return true
+		}
+	}
+
+	return false
+}
+
+// rebuildIndexes replaces the indexes with new ones built from the loaded
+// shapes. The new indexes are built before being swapped so that queries
+// aren't blocked meanwhile.
+// Shapes are never added to an index that was already queried: this version
+// of s2 deadlocks when a query applies incremental updates to a built index.
+// The places still referenced are moved to a new place table, swapped along
+// with the indexes, so that the places of unloaded or reloaded shapes are
+// freed.
+func (g *ReverseGeocoder) rebuildIndexes() {
+	index := s2.NewShapeIndex()
+	var localities *s2.ShapeIndex
+	if g.localities != nil {
+		localities = s2.NewShapeIndex()
+	}
+	table := newPlaceTable()
+	places := make(map[int64]*Place)
+	var coverings *coveringTable
+	if g.coverer != nil {
+		coverings = newCoveringTable()
+	}
+	var polygons int64
+
+	// the polygons of a place keep sharing it
+	moved := make(map[uint32]uint32)
+	move := func(i uint32) (uint32, *Place) {
+		j, ok := moved[i]
+		if !ok {
+			j = table.add(*g.placeTable.get(i))
+			moved[i] = j
+		}
+		return j, table.get(j)
+	}
+
+	g.shapesMu.Lock()
+	defer g.shapesMu.Unlock()
+
+	for country, shapes := range g.shapes {
+		// the shapes are copied, the current ones are still served
+		rebuilt := make([]s2.Shape, 0, len(shapes))
+		for _, s := range shapes {
+			switch s := s.(type) {
+			case *placePoint:
+				i, place := move(s.place)
+				p := &placePoint{PointVector: s.PointVector, place: i}
+				localities.Add(p)
+				places[place.ID] = place
+				rebuilt = append(rebuilt, p)
+			case *placePolygon:
+				i, place := move(s.place)
+				p := &placePolygon{Polygon: s.Polygon, place: i, covering: s.covering}
+				index.Add(p)
+				places[place.ID] = place
+				polygons++
+				if coverings != nil {
+					if p.covering == nil {
+						// added without its cache file
+						p.covering = newPolygonCovering(g.coverer, p.Polygon)
+					}
+					coverings.add(p, place)
+				}
+				rebuilt = append(rebuilt, p)
+			}
+		}
+		g.shapes[country] = rebuilt
+	}
+	// places without id
+	delete(places, 0)
+
+	index.Build()
+	if localities != nil {
+		localities.Build()
+	}
+	if coverings != nil {
+		coverings.build()
+	}
+
+	g.indexMu.Lock()
+	g.index = index
+	g.localities = localities
+	g.placeTable = table
+	g.places = places
+	g.coverings = coverings
+	if g.cellCache != nil {
+		g.cellCache.reset()
+	}
+	g.indexMu.Unlock()
+
+	atomic.StoreInt64(&g.polygonsLoaded, polygons)
+}
+
+// recountPolygons sets the polygon counts of a country from its shapes.
+func (g *ReverseGeocoder) recountPolygons(country string) {
+	counts := make(map[string]int)
+
+	g.shapesMu.Lock()
+	for _, s := range g.shapes[country] {
+		if p, ok := s.(*placePolygon); ok {
+			counts[g.placeTable.get(p.place).PlaceType]++
+		}
+	}
+	g.shapesMu.Unlock()
+
+	g.statsMu.Lock()
+	defer g.statsMu.Unlock()
+
+	g.polygonCounts[country] = counts
+}
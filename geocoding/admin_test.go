@@ -0,0 +1,133 @@
+package geocoding
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testUpstreamGeocoder returns a geocoder whose repository of country xx is
+// a clone of a local upstream, so that it can be updated. Its upstream has a
+// locality at 10,10.
+func testUpstreamGeocoder(t *testing.T) *ReverseGeocoder {
+	t.Helper()
+
+	g := testGitRepoGeocoder(t)
+	writeSource(t, g, "data/1/1.geojson", 1, "Locality", "locality", 10, 10)
+	commit(t, g)
+
+	upstream := filepath.Join(filepath.Dir(g.reposFolder), "upstream")
+	runGitIn(t, filepath.Dir(upstream), "init", "-q", "--bare", upstream)
+	runGit(t, g, "remote", "add", "origin", upstream)
+	runGit(t, g, "push", "-q", "-u", "origin", "HEAD")
+
+	return g
+}
+
+func TestLoadCountry(t *testing.T) {
+	g := testUpstreamGeocoder(t)
+	g = NewReverseGeocoder(g.reposFolder, g.cacheFolder, nil, nil)
+
+	err := g.LoadCountry("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := g.LocationFromLatLng(10, 10); loc.Locality != "Locality" {
+		t.Errorf("got locality %q, want %q", loc.Locality, "Locality")
+	}
+	if got := g.LoadedCountries(); !reflect.DeepEqual(got, []string{"xx"}) {
+		t.Errorf("got loaded countries %v, want %v", got, []string{"xx"})
+	}
+
+	err = g.LoadCountry("xxx")
+	if err == nil {
+		t.Error("no error loading an invalid country code")
+	}
+}
+
+func TestReloadCountryFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		// reload reloads the country so that it fails
+		reload func(t *testing.T, g *ReverseGeocoder) error
+	}{
+		{
+			name: "canceled",
+			reload: func(t *testing.T, g *ReverseGeocoder) error {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return g.LoadCountryContext(ctx, "xx")
+			},
+		},
+		{
+			name: "repository and cache unavailable",
+			reload: func(t *testing.T, g *ReverseGeocoder) error {
+				runGit(t, g, "remote", "set-url", "origin", filepath.Join(t.TempDir(), "missing"))
+				manifest := currentCacheManifest()
+				manifest.SchemaVersion--
+				err := g.writeCacheManifest("xx", manifest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return g.LoadCountry("xx")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testUpstreamGeocoder(t)
+			err := g.LoadCountry("xx")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = tt.reload(t, g)
+			if err == nil {
+				t.Fatal("no error reloading the country")
+			}
+			if loc := g.LocationFromLatLng(10, 10); loc.Locality != "Locality" {
+				t.Errorf("got locality %q after a failed reload, want %q", loc.Locality, "Locality")
+			}
+			if s := g.Status()[0]; s.State != LoadStateStale || s.Error == "" {
+				t.Errorf("got status %+v, want stale with an error", s)
+			}
+			if got := g.LoadedCountries(); !reflect.DeepEqual(got, []string{"xx"}) {
+				t.Errorf("got loaded countries %v, want %v", got, []string{"xx"})
+			}
+		})
+	}
+}
+
+func TestUnloadCountry(t *testing.T) {
+	g := testUpstreamGeocoder(t)
+	err := g.LoadCountry("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.UnloadCountry("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := g.LocationFromLatLng(10, 10); loc.Locality != "" {
+		t.Errorf("got locality %q after unloading", loc.Locality)
+	}
+	if got := g.LoadedCountries(); len(got) != 0 {
+		t.Errorf("got loaded countries %v after unloading", got)
+	}
+	if s := g.Stats().Polygons["xx"]; len(s) != 0 {
+		t.Errorf("got polygon counts %v after unloading", s)
+	}
+	// the cache is kept
+	if !exists(t, g.cacheManifestFile("xx")) {
+		t.Error("cache removed")
+	}
+
+	err = g.UnloadCountry("xx")
+	if !errors.Is(err, ErrUnknownCountry) {
+		t.Errorf("got error %v unloading again, want %v", err, ErrUnknownCountry)
+	}
+}
@@ -0,0 +1,417 @@
+package geocoding
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cacheSchemaVersion is the version of the cache format, it must be
+// incremented whenever the format or the layout of the cache changes.
+const cacheSchemaVersion = 3
+
+// Polygon simplification parameters, changing them invalidates the cache.
+const (
+	simplifyThreshold          = 0.0001
+	simplifyMinPointsToKeep    = 0
+	simplifyAvoidIntersections = true
+	// polygons with a bigger bounding rectangle area (in steradians) are
+	// considered inverted
+	maxPolygonBoundArea = 10
+)
+
+// cacheManifest describes how the cache of a country was generated.
+type cacheManifest struct {
+	SchemaVersion int
+	Generator     generatorParams
+
+	// Commit is the last repository commit fully indexed with PlaceTypes
+	// enabled, used to only process the files changed since.
+	Commit     string `json:",omitempty"`
+	PlaceTypes string `json:",omitempty"`
+}
+
+type generatorParams struct {
+	SimplifyThreshold          float64
+	SimplifyMinPointsToKeep    int
+	SimplifyAvoidIntersections bool
+	MaxPolygonBoundArea        float64
+}
+
+func currentCacheManifest() cacheManifest {
+	return cacheManifest{
+		SchemaVersion: cacheSchemaVersion,
+		Generator: generatorParams{
+			SimplifyThreshold:          simplifyThreshold,
+			SimplifyMinPointsToKeep:    simplifyMinPointsToKeep,
+			SimplifyAvoidIntersections: simplifyAvoidIntersections,
+			MaxPolygonBoundArea:        maxPolygonBoundArea,
+		},
+	}
+}
+
+// compatible returns whether a cache generated with this manifest can be used
+// by the current version.
+func (m *cacheManifest) compatible() bool {
+	current := currentCacheManifest()
+	return m.SchemaVersion == current.SchemaVersion && m.Generator == current.Generator
+}
+
+// readCacheManifest returns the cache manifest of a country, or nil if it
+// doesn't exist or is invalid.
+func (g *ReverseGeocoder) readCacheManifest(country string) (*cacheManifest, error) {
+	b, err := os.ReadFile(g.cacheManifestFile(country))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var manifest cacheManifest
+	err = json.Unmarshal(b, &manifest)
+	if err != nil {
+		log.WithError(err).WithField("country", country).Warn("invalid cache manifest")
+		return nil, nil
+	}
+
+	return &manifest, nil
+}
+
+// cacheUpToDate returns whether the cache of a country was generated with a
+// compatible manifest.
+func (g *ReverseGeocoder) cacheUpToDate(country string) (bool, error) {
+	manifest, err := g.readCacheManifest(country)
+	if err != nil {
+		return false, err
+	}
+
+	return manifest != nil && manifest.compatible(), nil
+}
+
+// checkCacheManifest clears the cache of a country if it was generated with a
+// different manifest. The current manifest is only written once the country is
+// indexed, so that an interrupted index doesn't leave a partial cache that the
+// cache only mode would load as complete.
+func (g *ReverseGeocoder) checkCacheManifest(country string) error {
+	upToDate, err := g.cacheUpToDate(country)
+	if err != nil {
+		return err
+	}
+	if upToDate {
+		return nil
+	}
+
+	log.WithField("country", country).Info("cache is missing or outdated, rebuilding it")
+	err = os.RemoveAll(g.cachePath(country))
+	if err != nil {
+		return fmt.Errorf("error clearing cache: %w", err)
+	}
+	err = g.createCacheFolder(country)
+	if err != nil {
+		return fmt.Errorf("could not create cache directory: %w", err)
+	}
+
+	return nil
+}
+
+// setIndexedCommit records the last commit fully indexed for a country.
+func (g *ReverseGeocoder) setIndexedCommit(country, commit string) error {
+	manifest := currentCacheManifest()
+	manifest.Commit = commit
+	manifest.PlaceTypes = g.placeTypesKey()
+
+	return g.writeCacheManifest(country, manifest)
+}
+
+func (g *ReverseGeocoder) writeCacheManifest(country string, manifest cacheManifest) error {
+	return writeFileAtomic(g.cacheManifestFile(country), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(manifest)
+	})
+}
+
+func (g *ReverseGeocoder) cacheManifestFile(country string) string {
+	return filepath.Join(g.cachePath(country), "manifest.json")
+}
+
+// CountryCache describes the cache of a country.
+type CountryCache struct {
+	Country string
+	// Files is the number of cached source files and Bytes the size of the
+	// cache.
+	Files int
+	Bytes int64
+	// UpToDate is false when the cache is missing or was generated by an
+	// incompatible version.
+	UpToDate bool
+	// Commit is the last repository commit indexed, when known.
+	Commit string `json:",omitempty"`
+}
+
+// CacheStats returns the cache statistics of all the countries.
+func (g *ReverseGeocoder) CacheStats() ([]CountryCache, error) {
+	var res []CountryCache
+	for _, country := range g.countriesList() {
+		c := CountryCache{Country: country}
+
+		manifest, err := g.readCacheManifest(country)
+		if err != nil {
+			return res, fmt.Errorf("error reading %q cache manifest: %w", country, err)
+		}
+		if manifest != nil {
+			c.UpToDate = manifest.compatible()
+			c.Commit = manifest.Commit
+		}
+
+		err = filepath.Walk(g.cachePath(country), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+
+			if !info.IsDir() {
+				c.Bytes += info.Size()
+			}
+			if strings.HasSuffix(path, ".geojson") {
+				c.Files++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return res, fmt.Errorf("error walking %q cache: %w", country, err)
+		}
+
+		res = append(res, c)
+	}
+
+	return res, nil
+}
+
+// GarbageCollectCache removes the cache files whose source file no longer
+// exists in the countries repositories, and returns their paths.
+// If dryRun is true the files are only reported.
+// Countries whose repository wasn't cloned, e.g. in cache only deployments,
+// are skipped and returned, as every cache file would look orphaned.
+func (g *ReverseGeocoder) GarbageCollectCache(dryRun bool) (orphans, skipped []string, err error) {
+	for _, country := range g.countriesList() {
+		if _, err := os.Stat(g.repoPath(country)); os.IsNotExist(err) {
+			skipped = append(skipped, country)
+			continue
+		}
+
+		keep, err := g.sourceCacheFiles(country)
+		if err != nil {
+			return orphans, skipped, fmt.Errorf("error listing %q source files: %w", country, err)
+		}
+
+		res, err := g.pruneCache(country, keep, dryRun)
+		orphans = append(orphans, res...)
+		if err != nil {
+			return orphans, skipped, fmt.Errorf("error pruning %q cache: %w", country, err)
+		}
+	}
+
+	return orphans, skipped, nil
+}
+
+// sourceCacheFiles returns the cache files matching the current source files
+// of a country.
+func (g *ReverseGeocoder) sourceCacheFiles(country string) (map[string]struct{}, error) {
+	repoPath := g.repoPath(country)
+	if _, err := os.Stat(repoPath); err != nil {
+		return nil, fmt.Errorf("error checking repository: %w", err)
+	}
+
+	res := make(map[string]struct{})
+	err := filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if strings.HasSuffix(path, ".geojson") {
+			res[filepath.Clean(g.cacheFile(country, path))] = struct{}{}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// pruneCache removes the cache files of a country that are not in keep, and
+// returns their paths. keep paths must be cleaned.
+func (g *ReverseGeocoder) pruneCache(country string, keep map[string]struct{}, dryRun bool) ([]string, error) {
+	var orphans []string
+	err := filepath.Walk(g.cachePath(country), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if strings.HasSuffix(path, tmpSuffix) {
+			// leftover from an interrupted write
+			if dryRun {
+				return nil
+			}
+			return os.Remove(path)
+		}
+		if !strings.HasSuffix(path, ".geojson") {
+			return nil
+		}
+		if _, ok := keep[filepath.Clean(path)]; ok {
+			return nil
+		}
+
+		orphans = append(orphans, path)
+		if dryRun {
+			return nil
+		}
+
+		return os.Remove(path)
+	})
+	if err != nil {
+		return orphans, err
+	}
+
+	if len(orphans) > 0 && !dryRun {
+		log.WithField("country", country).Infof("removed %d orphaned cache files", len(orphans))
+	}
+
+	return orphans, nil
+}
+
+// sourceDeleted returns whether the source of a cache entry is known to have
+// been deleted from the country repository. If the repository isn't available
+// the entry is assumed valid.
+func (g *ReverseGeocoder) sourceDeleted(country string, cache *cachedFile) bool {
+	if cache.Source == "" {
+		return false
+	}
+
+	repoPath := g.repoPath(country)
+	if _, err := os.Stat(repoPath); err != nil {
+		return false
+	}
+
+	_, err := os.Stat(filepath.Join(repoPath, cache.Source))
+	return os.IsNotExist(err)
+}
+
+// sourcePath returns the path of a source file relative to its country
+// repository.
+func (g *ReverseGeocoder) sourcePath(country, path string) string {
+	rel, err := filepath.Rel(g.repoPath(country), path)
+	if err != nil {
+		return path
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+const tmpSuffix = ".tmp"
+
+// writeFileAtomic writes a file through a temporary file which is renamed once
+// complete, so that a crash never leaves a partially written file.
+func writeFileAtomic(path string, write func(w io.Writer) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*"+tmpSuffix)
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	err = write(f)
+	if err != nil {
+		return err
+	}
+	err = f.Chmod(0644)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func readCacheFile(path string) (*cachedFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cache cachedFile
+	err = json.Unmarshal(b, &cache)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cache, nil
+}
+
+// recoverCacheFile quarantines a corrupt cache file and processes its source
+// again when the repository is available. It returns nil if the entry couldn't
+// be recovered.
+func (g *ReverseGeocoder) recoverCacheFile(country, path string) *cachedFile {
+	logger := log.WithField("path", path)
+
+	err := g.quarantineCacheFile(country, path)
+	if err != nil {
+		logger.WithError(err).Error("error quarantining cache file")
+	}
+
+	rel, err := filepath.Rel(g.cachePath(country), path)
+	if err != nil {
+		return nil
+	}
+	source := filepath.Join(g.repoPath(country), rel)
+	if _, err := os.Stat(source); err != nil {
+		logger.Warn("source file not available, skipping corrupt cache file")
+		return nil
+	}
+
+	cache, err := g.processGeojson(country, source)
+	if err != nil {
+		logger.WithError(err).Error("error processing source of corrupt cache file")
+		return nil
+	}
+
+	return cache
+}
+
+// quarantineCacheFile moves a corrupt cache file out of the country cache to
+// <cacheFolder>/quarantine/<country>.
+func (g *ReverseGeocoder) quarantineCacheFile(country, path string) error {
+	rel, err := filepath.Rel(g.cachePath(country), path)
+	if err != nil {
+		return err
+	}
+
+	dst := filepath.Join(g.cacheFolder, "quarantine", country, rel)
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(path, dst)
+}
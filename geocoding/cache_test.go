@@ -0,0 +1,534 @@
+package geocoding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testRepoGeocoder returns a geocoder for country xx with an empty repository.
+func testRepoGeocoder(t *testing.T, opts ...Option) *ReverseGeocoder {
+	t.Helper()
+
+	dir := t.TempDir()
+	g := NewReverseGeocoder(filepath.Join(dir, "repos"), filepath.Join(dir, "cache"), []string{"xx"}, nil, opts...)
+	err := os.MkdirAll(g.repoPath("xx"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return g
+}
+
+// writeSource writes a WOF source file to the repository of country xx, with
+// a 0.5° square polygon centered on lat, lng. It returns the file path.
+func writeSource(t *testing.T, g *ReverseGeocoder, rel string, id int64, name, placeType string, lat, lng float64) string {
+	t.Helper()
+
+	const d = 0.25
+	b, err := json.Marshal(map[string]interface{}{
+		"type": "Feature",
+		"properties": map[string]interface{}{
+			"wof:id":        id,
+			"wof:name":      name,
+			"wof:placetype": placeType,
+			"wof:country":   "XX",
+		},
+		"geometry": map[string]interface{}{
+			"type": "Polygon",
+			"coordinates": [][][]float64{{
+				{lng - d, lat - d}, {lng + d, lat - d}, {lng + d, lat + d}, {lng - d, lat + d}, {lng - d, lat - d},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(g.repoPath("xx"), filepath.FromSlash(rel))
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// exists returns whether a file exists.
+func exists(t *testing.T, path string) bool {
+	t.Helper()
+
+	_, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	return err == nil
+}
+
+func TestGarbageCollectCache(t *testing.T) {
+	g := testRepoGeocoder(t)
+	writeSource(t, g, "data/1/1.geojson", 1, "Kept", "locality", 10, 10)
+	deleted := writeSource(t, g, "data/2/2.geojson", 2, "Deleted", "locality", 20, 20)
+	err := g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Remove(deleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphan := g.cacheFile("xx", deleted)
+	kept := g.cacheFile("xx", filepath.Join(g.repoPath("xx"), "data/1/1.geojson"))
+
+	removed, _, err := g.GarbageCollectCache(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, []string{orphan}) {
+		t.Errorf("got orphans %v, want %v", removed, []string{orphan})
+	}
+	if !exists(t, orphan) {
+		t.Error("orphan removed by a dry run")
+	}
+
+	removed, _, err = g.GarbageCollectCache(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, []string{orphan}) {
+		t.Errorf("got orphans %v, want %v", removed, []string{orphan})
+	}
+	if exists(t, orphan) {
+		t.Error("orphan not removed")
+	}
+	if !exists(t, kept) {
+		t.Error("cache file of an existing source removed")
+	}
+	if !exists(t, g.cacheManifestFile("xx")) {
+		t.Error("cache manifest removed")
+	}
+
+	removed, _, err = g.GarbageCollectCache(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("got orphans %v after collecting, want none", removed)
+	}
+}
+
+func TestGarbageCollectCacheWithoutRepository(t *testing.T) {
+	g := testRepoGeocoder(t)
+	writeSource(t, g, "data/1/1.geojson", 1, "Kept", "locality", 10, 10)
+	err := g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.RemoveAll(g.repoPath("xx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without the repository every cache file would look orphaned
+	removed, skipped, err := g.GarbageCollectCache(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("got orphans %v without a repository, want none", removed)
+	}
+	if !reflect.DeepEqual(skipped, []string{"xx"}) {
+		t.Errorf("got skipped countries %v, want %v", skipped, []string{"xx"})
+	}
+	if !exists(t, g.cacheFile("xx", filepath.Join(g.repoPath("xx"), "data/1/1.geojson"))) {
+		t.Error("cache file removed")
+	}
+}
+
+func TestCacheOnlySkipsDeletedSources(t *testing.T) {
+	g := testRepoGeocoder(t)
+	writeSource(t, g, "data/1/1.geojson", 1, "Kept", "locality", 10, 10)
+	deleted := writeSource(t, g, "data/2/2.geojson", 2, "Deleted", "locality", 20, 20)
+	err := g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := g.LocationFromLatLng(20, 20); loc.Locality != "Deleted" {
+		t.Fatalf("got locality %q, want %q", loc.Locality, "Deleted")
+	}
+
+	err = os.Remove(deleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := g.LocationFromLatLng(20, 20); loc.Locality != "" {
+		t.Errorf("got locality %q from a deleted source", loc.Locality)
+	}
+	if loc := g.LocationFromLatLng(10, 10); loc.Locality != "Kept" {
+		t.Errorf("got locality %q, want %q", loc.Locality, "Kept")
+	}
+
+	// without the repository cache entries are assumed valid
+	err = os.RemoveAll(g.repoPath("xx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists(t, g.cacheFile("xx", deleted)) {
+		t.Fatal("orphan removed")
+	}
+	err = g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := g.LocationFromLatLng(20, 20); loc.Locality != "Deleted" {
+		t.Errorf("got locality %q, want %q", loc.Locality, "Deleted")
+	}
+}
+
+func TestCacheManifestMismatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(m *cacheManifest)
+	}{
+		{
+			name:   "schema version",
+			modify: func(m *cacheManifest) { m.SchemaVersion-- },
+		},
+		{
+			name:   "simplification threshold",
+			modify: func(m *cacheManifest) { m.Generator.SimplifyThreshold *= 2 },
+		},
+		{
+			name: "simplification intersections",
+			modify: func(m *cacheManifest) {
+				m.Generator.SimplifyAvoidIntersections = !m.Generator.SimplifyAvoidIntersections
+			},
+		},
+		{
+			name:   "max polygon area",
+			modify: func(m *cacheManifest) { m.Generator.MaxPolygonBoundArea++ },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testRepoGeocoder(t)
+			writeSource(t, g, "data/1/1.geojson", 1, "Locality", "locality", 10, 10)
+			err := g.LoadCachedFiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			manifest := currentCacheManifest()
+			tt.modify(&manifest)
+			err = g.writeCacheManifest("xx", manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// a file only an older version would have written
+			stale := filepath.Join(g.cachePath("xx"), "data", "stale.geojson")
+			err = os.WriteFile(stale, []byte("{}"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			upToDate, err := g.cacheUpToDate("xx")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if upToDate {
+				t.Fatal("cache up to date with a different manifest")
+			}
+
+			err = g.LoadCachedFiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists(t, stale) {
+				t.Error("cache not rebuilt")
+			}
+			upToDate, err = g.cacheUpToDate("xx")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !upToDate {
+				t.Error("cache outdated after rebuilding it")
+			}
+			if loc := g.LocationFromLatLng(10, 10); loc.Locality != "Locality" {
+				t.Errorf("got locality %q, want %q", loc.Locality, "Locality")
+			}
+
+			// without the repository an outdated cache can't be rebuilt
+			err = g.writeCacheManifest("xx", manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.RemoveAll(g.repoPath("xx"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			g = NewReverseGeocoder(g.reposFolder, g.cacheFolder, []string{"xx"}, nil)
+			err = g.LoadCachedFiles()
+			if !errors.Is(err, ErrCountriesFailed) {
+				t.Errorf("got error %v, want %v", err, ErrCountriesFailed)
+			}
+		})
+	}
+}
+
+func TestCacheRebuildInterrupted(t *testing.T) {
+	g := testRepoGeocoder(t)
+	writeSource(t, g, "data/1/1.geojson", 1, "Locality", "locality", 10, 10)
+	err := g.createCacheFolder("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := currentCacheManifest()
+	manifest.SchemaVersion--
+	err = g.writeCacheManifest("xx", manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = g.indexCountry(ctx, "xx")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if exists(t, g.cacheManifestFile("xx")) {
+		t.Fatal("cache manifest written before the cache was rebuilt")
+	}
+
+	// the partial cache isn't loaded without the repository
+	err = os.RemoveAll(g.repoPath("xx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.LoadCachedFiles()
+	if !errors.Is(err, ErrCountriesFailed) {
+		t.Errorf("got error %v, want %v", err, ErrCountriesFailed)
+	}
+	if g.Loaded("xx") {
+		t.Error("partial cache loaded")
+	}
+}
+
+func TestCacheSameBasename(t *testing.T) {
+	g := testRepoGeocoder(t)
+	first := writeSource(t, g, "data/101/1/1.geojson", 1, "First", "locality", 10, 10)
+	second := writeSource(t, g, "data/102/1/1.geojson", 2, "Second", "locality", 20, 20)
+	err := g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g.cacheFile("xx", first) == g.cacheFile("xx", second) {
+		t.Fatalf("both sources cached in %q", g.cacheFile("xx", first))
+	}
+	for _, path := range []string{first, second} {
+		if !exists(t, g.cacheFile("xx", path)) {
+			t.Errorf("%q not cached", path)
+		}
+	}
+
+	// both are served from the cache
+	err = g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := g.LocationFromLatLng(10, 10); loc.Locality != "First" {
+		t.Errorf("got locality %q, want %q", loc.Locality, "First")
+	}
+	if loc := g.LocationFromLatLng(20, 20); loc.Locality != "Second" {
+		t.Errorf("got locality %q, want %q", loc.Locality, "Second")
+	}
+}
+
+// truncate truncates a file to half its size.
+func truncate(t *testing.T, path string) {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Truncate(path, info.Size()/2)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCorruptCacheFile(t *testing.T) {
+	tests := []struct {
+		name string
+		load func(g *ReverseGeocoder) error
+	}{
+		{
+			name: "cache only",
+			load: func(g *ReverseGeocoder) error { return g.LoadCachedFiles() },
+		},
+		{
+			name: "indexing",
+			load: func(g *ReverseGeocoder) error {
+				_, err := g.indexAllFiles(context.Background(), "xx")
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testRepoGeocoder(t)
+			source := writeSource(t, g, "data/1/1.geojson", 1, "Corrupt", "locality", 10, 10)
+			writeSource(t, g, "data/2/2.geojson", 2, "Valid", "locality", 20, 20)
+			err := g.LoadCachedFiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cacheFile := g.cacheFile("xx", source)
+			truncate(t, cacheFile)
+
+			delete(g.shapes, "xx")
+			err = tt.load(g)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g.rebuildIndexes()
+
+			if !exists(t, filepath.Join(g.cacheFolder, "quarantine", "xx", "data", "1", "1.geojson")) {
+				t.Error("corrupt cache file not quarantined")
+			}
+			cache, err := readCacheFile(cacheFile)
+			if err != nil {
+				t.Fatalf("cache file not rewritten: %v", err)
+			}
+			if cache.Place.Name != "Corrupt" {
+				t.Errorf("got place %q in the rewritten cache, want %q", cache.Place.Name, "Corrupt")
+			}
+			if loc := g.LocationFromLatLng(10, 10); loc.Locality != "Corrupt" {
+				t.Errorf("got locality %q, want %q", loc.Locality, "Corrupt")
+			}
+		})
+	}
+}
+
+func TestCorruptCacheFileWithoutRepository(t *testing.T) {
+	g := testRepoGeocoder(t)
+	source := writeSource(t, g, "data/1/1.geojson", 1, "Corrupt", "locality", 10, 10)
+	writeSource(t, g, "data/2/2.geojson", 2, "Valid", "locality", 20, 20)
+	err := g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncate(t, g.cacheFile("xx", source))
+	err = os.RemoveAll(g.repoPath("xx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the corrupt entry is skipped, the others are loaded
+	err = g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := g.LocationFromLatLng(10, 10); loc.Locality != "" {
+		t.Errorf("got locality %q from a corrupt cache file", loc.Locality)
+	}
+	if loc := g.LocationFromLatLng(20, 20); loc.Locality != "Valid" {
+		t.Errorf("got locality %q, want %q", loc.Locality, "Valid")
+	}
+	if exists(t, g.cacheFile("xx", source)) {
+		t.Error("corrupt cache file not quarantined")
+	}
+}
+
+func TestTemporaryFilesCleanup(t *testing.T) {
+	g := testRepoGeocoder(t)
+	source := writeSource(t, g, "data/1/1.geojson", 1, "Locality", "locality", 10, 10)
+	err := g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// leftover from a crash during a write
+	leftover := g.cacheFile("xx", source) + ".123456" + tmpSuffix
+	err = os.WriteFile(leftover, []byte(`{"Valid":`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// loading the cache ignores it
+	err = g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := g.LocationFromLatLng(10, 10); loc.Locality != "Locality" {
+		t.Errorf("got locality %q, want %q", loc.Locality, "Locality")
+	}
+
+	// a dry run keeps it and indexing removes it
+	_, _, err = g.GarbageCollectCache(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists(t, leftover) {
+		t.Error("temporary file removed by a dry run")
+	}
+	_, err = g.indexAllFiles(context.Background(), "xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists(t, leftover) {
+		t.Error("temporary file not removed")
+	}
+}
+
+func TestWriteFileAtomicError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.json")
+	err := os.WriteFile(path, []byte("previous"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeErr := errors.New("write error")
+	err = writeFileAtomic(path, func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return writeErr
+	})
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("got error %v, want %v", err, writeErr)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "previous" {
+		t.Errorf("got content %q, want %q", b, "previous")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files, want the temporary file removed", len(entries))
+	}
+}
@@ -0,0 +1,182 @@
+package geocoding
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+)
+
+// cellBoundaryMargin is how close to a cell a polygon edge must be to count as
+// crossing it, so that rounding errors can't make a cached result wrong.
+var cellBoundaryMargin = s1.ChordAngleFromAngle(1e-9)
+
+// maxCellLevel is the level of the smallest S2 cells.
+const maxCellLevel = 30
+
+// WithCellCache enables a LRU of up to size lookup results, keyed by the S2
+// cell at the given level (0 to 30) containing the point. Only cells that no
+// polygon boundary crosses are cached, as all their points have the same
+// result.
+func WithCellCache(level, size int) Option {
+	return func(g *ReverseGeocoder) {
+		if size > 0 && level >= 0 && level <= maxCellLevel {
+			g.cellCache = newCellCache(level, size)
+		}
+	}
+}
+
+// cellCache is a LRU of lookup results by S2 cell. Cells crossed by a boundary
+// are kept too, so that they are only checked once.
+type cellCache struct {
+	level int
+	size  int
+
+	mu      sync.Mutex
+	entries map[s2.CellID]*list.Element
+	lru     *list.List
+
+	hits   int64
+	misses int64
+}
+
+// cellEntry is the lookup result of all the points of a cell.
+type cellEntry struct {
+	cell s2.CellID
+	// boundary is set for cells crossed by a boundary, whose points must be
+	// looked up in the index
+	boundary bool
+	places   []*Place
+	timezone *timezonePolygon
+}
+
+func newCellCache(level, size int) *cellCache {
+	return &cellCache{
+		level:   level,
+		size:    size,
+		entries: make(map[s2.CellID]*list.Element, size),
+		lru:     list.New(),
+	}
+}
+
+func (c *cellCache) get(cell s2.CellID) (*cellEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[cell]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+
+	return e.Value.(*cellEntry), true
+}
+
+func (c *cellCache) add(entry *cellEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[entry.cell]; ok {
+		// added concurrently
+		return
+	}
+	c.entries[entry.cell] = c.lru.PushFront(entry)
+
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cellEntry).cell)
+	}
+}
+
+func (c *cellCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// reset empties the cache, it must be called when the indexes change.
+func (c *cellCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[s2.CellID]*list.Element, c.size)
+	c.lru.Init()
+}
+
+// cachedCell returns the cached result of the cell containing pt, or nil if
+// the cache is disabled or the cell is crossed by a boundary. It must be
+// called with indexMu held.
+func (g *ReverseGeocoder) cachedCell(pt s2.Point) *cellEntry {
+	if g.cellCache == nil {
+		return nil
+	}
+
+	cell := s2.CellFromPoint(pt).ID().Parent(g.cellCache.level)
+	entry, ok := g.cellCache.get(cell)
+	if !ok {
+		entry = g.newCellEntry(cell)
+		g.cellCache.add(entry)
+	}
+
+	if entry.boundary {
+		atomic.AddInt64(&g.cellCache.misses, 1)
+		return nil
+	}
+	if ok {
+		atomic.AddInt64(&g.cellCache.hits, 1)
+	} else {
+		atomic.AddInt64(&g.cellCache.misses, 1)
+	}
+
+	return entry
+}
+
+// newCellEntry returns the result of a cell from the polygon and timezone
+// indexes.
+func (g *ReverseGeocoder) newCellEntry(id s2.CellID) *cellEntry {
+	cell := s2.CellFromCellID(id)
+	entry := &cellEntry{cell: id}
+
+	shapes, ok := interiorShapes(g.index, cell)
+	if !ok {
+		entry.boundary = true
+		return entry
+	}
+	for _, s := range shapes {
+		entry.places = append(entry.places, g.placeTable.get(s.(*placePolygon).place))
+	}
+
+	if g.timezones != nil {
+		shapes, ok := interiorShapes(g.timezones, cell)
+		if !ok {
+			entry.boundary = true
+			return entry
+		}
+		if len(shapes) > 0 {
+			entry.timezone = shapes[0].(*timezonePolygon)
+		}
+	}
+
+	return entry
+}
+
+// interiorShapes returns the shapes containing a cell, or false if an edge
+// is in or near the cell, i.e. if some shapes only contain part of it.
+func interiorShapes(index *s2.ShapeIndex, cell s2.Cell) ([]s2.Shape, bool) {
+	opts := s2.NewClosestEdgeQueryOptions().IncludeInteriors(true).DistanceLimit(cellBoundaryMargin)
+	q := s2.NewClosestEdgeQuery(index, opts)
+
+	var res []s2.Shape
+	for _, r := range q.FindEdges(s2.NewMinDistanceToCellTarget(cell)) {
+		if !r.IsInterior() {
+			return nil, false
+		}
+		res = append(res, index.Shape(r.ShapeID()))
+	}
+
+	return res, true
+}
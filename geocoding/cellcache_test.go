@@ -0,0 +1,191 @@
+package geocoding
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+)
+
+// testGeocoder returns a geocoder with a country, a grid of regions inside it
+// and a locality in each region, all of them regular polygons with many
+// vertices like real boundaries.
+func testGeocoder(opts ...Option) *ReverseGeocoder {
+	g := NewReverseGeocoder("", "", []string{"xx"}, nil, opts...)
+
+	addPolygon := func(id int64, placeType string, lat, lng, radius float64) {
+		center := s2.PointFromLatLng(s2.LatLngFromDegrees(lat, lng))
+		loop := s2.RegularLoop(center, s1.Angle(radius)*s1.Degree, 1000)
+		g.addCachedFile("xx", &cachedFile{
+			Valid: true,
+			Place: Place{
+				ID:        id,
+				Name:      fmt.Sprintf("%s %d", placeType, id),
+				PlaceType: placeType,
+				Country:   "XX",
+			},
+			Polygons: polygons{s2.PolygonFromLoops([]*s2.Loop{loop})},
+		})
+	}
+
+	addPolygon(1, "country", 45, 5, 6)
+	id := int64(2)
+	for lat := 41.0; lat <= 49; lat += 2 {
+		for lng := 1.0; lng <= 9; lng += 2 {
+			addPolygon(id, "region", lat, lng, 0.6)
+			addPolygon(id+1, "locality", lat, lng, 0.2)
+			id += 2
+		}
+	}
+	g.rebuildIndexes()
+
+	return g
+}
+
+// testPoints returns random points around the test geocoder polygons.
+func testPoints(n int) [][2]float64 {
+	r := rand.New(rand.NewSource(1))
+	res := make([][2]float64, n)
+	for i := range res {
+		res[i] = [2]float64{38 + r.Float64()*14, -2 + r.Float64()*14}
+	}
+
+	return res
+}
+
+// addTestTimezones splits the area of testGeocoder in two timezones along the
+// 5°E meridian, which goes through a column of regions and localities.
+func addTestTimezones(t *testing.T, g *ReverseGeocoder) {
+	t.Helper()
+
+	rect := func(minLng, maxLng float64) *s2.Polygon {
+		var points []s2.Point
+		for _, ll := range [][2]float64{{30, minLng}, {30, maxLng}, {60, maxLng}, {60, minLng}} {
+			points = append(points, s2.PointFromLatLng(s2.LatLngFromDegrees(ll[0], ll[1])))
+		}
+		return s2.PolygonFromLoops([]*s2.Loop{s2.LoopFromPoints(points)})
+	}
+
+	index := s2.NewShapeIndex()
+	for _, tz := range []struct {
+		id             string
+		minLng, maxLng float64
+	}{
+		{"Europe/Paris", -10, 5},
+		{"Europe/Berlin", 5, 20},
+	} {
+		loc, err := time.LoadLocation(tz.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index.Add(&timezonePolygon{Polygon: rect(tz.minLng, tz.maxLng), TZID: tz.id, Location: loc})
+	}
+	index.Build()
+
+	g.indexMu.Lock()
+	g.timezones = index
+	if g.cellCache != nil {
+		g.cellCache.reset()
+	}
+	g.indexMu.Unlock()
+}
+
+// boundaryPoints returns points on and right around the vertices and edges
+// of the polygons of g, and of the timezone boundary.
+func boundaryPoints(g *ReverseGeocoder) [][2]float64 {
+	var res [][2]float64
+	around := func(ll s2.LatLng) {
+		lat, lng := ll.Lat.Degrees(), ll.Lng.Degrees()
+		for _, d := range []float64{0, 1e-9, -1e-6} {
+			res = append(res, [2]float64{lat + d, lng}, [2]float64{lat, lng + d})
+		}
+	}
+
+	for _, s := range g.shapes["xx"] {
+		loop := s.(*placePolygon).Loop(0)
+		for i := 0; i < loop.NumVertices(); i += 500 {
+			around(s2.LatLngFromPoint(loop.Vertex(i)))
+			around(s2.LatLngFromPoint(s2.Interpolate(0.5, loop.Vertex(i), loop.Vertex(i+1))))
+		}
+	}
+	for lat := 38.0; lat <= 52; lat += 1 {
+		around(s2.LatLngFromDegrees(lat, 5))
+	}
+
+	return res
+}
+
+// withoutPolygons returns a copy of loc whose places have no polygons, so that
+// the locations of two geocoders are compared without walking every vertex.
+func withoutPolygons(loc Location) Location {
+	places := make(map[string]*Place, len(loc.Places))
+	for placeType, p := range loc.Places {
+		place := *p
+		place.polygons = nil
+		places[placeType] = &place
+	}
+	loc.Places = places
+
+	return loc
+}
+
+func TestCellCacheMatchesIndex(t *testing.T) {
+	// building the geocoder is slow under the race detector, so the cases share
+	// it and only swap its cell cache
+	g := testGeocoder()
+	addTestTimezones(t, g)
+
+	tests := []struct {
+		name        string
+		level, size int
+	}{
+		{name: "large cells", level: 10, size: 1 << 16},
+		{name: "small cells", level: 16, size: 1 << 16},
+		// most entries are evicted before being used again
+		{name: "small cache", level: 8, size: 256},
+	}
+
+	points := append(testPoints(200), boundaryPoints(g)...)
+	want := make([]Location, len(points))
+	for i, p := range points {
+		want[i] = withoutPolygons(*g.LocationFromLatLng(p[0], p[1]))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g.cellCache = newCellCache(tt.level, tt.size)
+			defer func() { g.cellCache = nil }()
+
+			// twice, so that the second lookups are answered from the cache
+			for i := 0; i < 2; i++ {
+				for j, p := range points {
+					got := withoutPolygons(*g.LocationFromLatLng(p[0], p[1]))
+					if !reflect.DeepEqual(got, want[j]) {
+						t.Fatalf("%v: got %v, want %v", p, got, want[j])
+					}
+				}
+			}
+
+			stats := g.Stats()
+			if stats.CellCacheHits == 0 {
+				t.Errorf("no lookup answered from the cell cache")
+			}
+			if stats.CellCacheEntries > tt.size {
+				t.Errorf("got %d entries, want at most %d", stats.CellCacheEntries, tt.size)
+			}
+			t.Logf("%d hits, %d misses", stats.CellCacheHits, stats.CellCacheMisses)
+		})
+	}
+
+	// both timezones are found
+	if loc := g.LocationFromLatLng(45, 4.99); loc.Timezone != "Europe/Paris" {
+		t.Errorf("got timezone %q west of the boundary, want %q", loc.Timezone, "Europe/Paris")
+	}
+	if loc := g.LocationFromLatLng(45, 5.01); loc.Timezone != "Europe/Berlin" {
+		t.Errorf("got timezone %q east of the boundary, want %q", loc.Timezone, "Europe/Berlin")
+	}
+}
@@ -0,0 +1,232 @@
+package geocoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/golang/geo/s2"
+)
+
+// WithCoverings enables the precomputed covering table: each polygon is
+// covered with up to maxCells S2 cells of level 0 to maxLevel, and the points
+// in cells strictly inside or outside all polygons are looked up in the table
+// instead of the index. Coverings are stored in the cache, they are computed
+// when loading cache files without them or with different parameters.
+func WithCoverings(maxLevel, maxCells int) Option {
+	return func(g *ReverseGeocoder) {
+		if maxCells > 0 && maxLevel >= 0 && maxLevel <= maxCellLevel {
+			g.coverer = &s2.RegionCoverer{MaxLevel: maxLevel, MaxCells: maxCells}
+		}
+	}
+}
+
+// coveringParams are the parameters the coverings of a cache file were
+// computed with.
+type coveringParams struct {
+	MaxLevel int
+	MaxCells int
+}
+
+// polygonCovering is the covering of a polygon: the points of the Interior
+// cells are in the polygon, those of the Boundary cells may be, and the other
+// points are not.
+type polygonCovering struct {
+	Interior cellUnion
+	Boundary cellUnion
+}
+
+func newPolygonCovering(coverer *s2.RegionCoverer, p *s2.Polygon) *polygonCovering {
+	interior := coverer.InteriorCovering(p)
+	covering := coverer.Covering(p)
+
+	return &polygonCovering{
+		Interior: cellUnion(interior),
+		Boundary: cellUnion(s2.CellUnionFromDifference(covering, interior)),
+	}
+}
+
+type cellUnion s2.CellUnion
+
+func (c cellUnion) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	cu := s2.CellUnion(c)
+	err := cu.Encode(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding cell union: %w", err)
+	}
+	return json.Marshal(buf.Bytes())
+}
+
+func (c *cellUnion) UnmarshalJSON(data []byte) error {
+	var encoded []byte
+	err := json.Unmarshal(data, &encoded)
+	if err != nil {
+		return err
+	}
+
+	var cu s2.CellUnion
+	err = cu.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		return fmt.Errorf("error decoding cell union: %w", err)
+	}
+	*c = cellUnion(cu)
+
+	return nil
+}
+
+// ensureCoverings computes the coverings of a cache file if they are enabled
+// and missing or outdated, it returns whether they were.
+func (g *ReverseGeocoder) ensureCoverings(cache *cachedFile) bool {
+	if g.coverer == nil || len(cache.Polygons) == 0 {
+		return false
+	}
+	params := coveringParams{
+		MaxLevel: g.coverer.MaxLevel,
+		MaxCells: g.coverer.MaxCells,
+	}
+	if cache.CoveringParams != nil && *cache.CoveringParams == params && len(cache.Coverings) == len(cache.Polygons) {
+		return false
+	}
+
+	cache.Coverings = make([]*polygonCovering, 0, len(cache.Polygons))
+	for _, p := range cache.Polygons {
+		cache.Coverings = append(cache.Coverings, newPolygonCovering(g.coverer, p))
+	}
+	cache.CoveringParams = &params
+
+	return true
+}
+
+// coveringTable maps the cells of the polygon coverings to the result of
+// their points. Cells are sorted so that the cell of a point is found with a
+// binary search, each cell result includes those of the cells containing it.
+type coveringTable struct {
+	cells   []s2.CellID
+	entries []coveringEntry
+
+	// pending are the cells added since the table was last built
+	pending map[s2.CellID]*coveringEntry
+}
+
+type coveringEntry struct {
+	// parent is the index of the closest cell containing this one, -1 if
+	// there is none
+	parent int
+	// boundary is set for cells crossed by a polygon boundary, whose points
+	// must be looked up in the index
+	boundary bool
+	places   []*Place
+}
+
+func newCoveringTable() *coveringTable {
+	return &coveringTable{
+		pending: make(map[s2.CellID]*coveringEntry),
+	}
+}
+
+// add adds the covering of a polygon of a place, build must be called once
+// all polygons are added.
+func (t *coveringTable) add(p *placePolygon, place *Place) {
+	for _, id := range p.covering.Interior {
+		e := t.pendingEntry(id)
+		e.places = append(e.places, place)
+	}
+	for _, id := range p.covering.Boundary {
+		t.pendingEntry(id).boundary = true
+	}
+}
+
+func (t *coveringTable) pendingEntry(id s2.CellID) *coveringEntry {
+	e, ok := t.pending[id]
+	if !ok {
+		e = &coveringEntry{}
+		t.pending[id] = e
+	}
+	return e
+}
+
+// build sorts the cells by range, containing cells first, and merges the
+// result of each cell with the results of the cells containing it.
+func (t *coveringTable) build() {
+	t.cells = make([]s2.CellID, 0, len(t.pending))
+	for id := range t.pending {
+		t.cells = append(t.cells, id)
+	}
+	sort.Slice(t.cells, func(i, j int) bool {
+		a, b := t.cells[i].RangeMin(), t.cells[j].RangeMin()
+		if a != b {
+			return a < b
+		}
+		return t.cells[i].Level() < t.cells[j].Level()
+	})
+
+	t.entries = make([]coveringEntry, len(t.cells))
+	// containing cells of the current cell, S2 cells are either disjoint or
+	// nested
+	var stack []int
+	for i, id := range t.cells {
+		for len(stack) > 0 && !t.cells[stack[len(stack)-1]].Contains(id) {
+			stack = stack[:len(stack)-1]
+		}
+
+		e := t.pending[id]
+		entry := coveringEntry{
+			parent:   -1,
+			boundary: e.boundary,
+			places:   e.places,
+		}
+		if len(stack) > 0 {
+			parent := t.entries[stack[len(stack)-1]]
+			entry.parent = stack[len(stack)-1]
+			entry.boundary = entry.boundary || parent.boundary
+			entry.places = append(append([]*Place(nil), parent.places...), e.places...)
+		}
+		t.entries[i] = entry
+		stack = append(stack, i)
+	}
+	t.pending = nil
+}
+
+// places returns the places whose polygons contain pt, or false if pt is in
+// a boundary cell. The returned slice must not be modified.
+func (t *coveringTable) places(pt s2.Point) ([]*Place, bool) {
+	leaf := s2.CellFromPoint(pt).ID()
+
+	// the last cell starting before the point, the cell containing it is
+	// either this one or one of its parents
+	i := sort.Search(len(t.cells), func(i int) bool {
+		return t.cells[i].RangeMin() > leaf
+	}) - 1
+	for i >= 0 && !t.cells[i].Contains(leaf) {
+		i = t.entries[i].parent
+	}
+	if i < 0 {
+		return nil, true
+	}
+	if t.entries[i].boundary {
+		return nil, false
+	}
+
+	return t.entries[i].places, true
+}
+
+// coveredPlaces returns the places containing pt from the covering table, or
+// false if it is disabled or pt is near a boundary. It must be called with
+// indexMu held.
+func (g *ReverseGeocoder) coveredPlaces(pt s2.Point) ([]*Place, bool) {
+	if g.coverings == nil {
+		return nil, false
+	}
+
+	res, ok := g.coverings.places(pt)
+	if ok {
+		atomic.AddInt64(&g.coveringHits, 1)
+	} else {
+		atomic.AddInt64(&g.coveringFallbacks, 1)
+	}
+
+	return res, ok
+}
@@ -0,0 +1,80 @@
+package geocoding
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCoveringsMatchIndex(t *testing.T) {
+	index := testGeocoder()
+	coverings := testGeocoder(WithCoverings(16, 64))
+
+	for _, p := range testPoints(100000) {
+		want := index.LocationFromLatLng(p[0], p[1])
+		got := coverings.LocationFromLatLng(p[0], p[1])
+		if !reflect.DeepEqual(withoutPolygons(*got), withoutPolygons(*want)) {
+			t.Fatalf("%v: got %v, want %v", p, got, want)
+		}
+	}
+
+	stats := coverings.Stats()
+	if stats.CoveringHits == 0 {
+		t.Errorf("no lookup answered from the covering table")
+	}
+	t.Logf("%d hits, %d fallbacks", stats.CoveringHits, stats.CoveringFallbacks)
+}
+
+func TestCoveringsCache(t *testing.T) {
+	g := testGeocoder(WithCoverings(16, 64))
+	cache := &cachedFile{
+		Valid:    true,
+		Polygons: polygons{g.shapes["xx"][0].(*placePolygon).Polygon},
+	}
+
+	if !g.ensureCoverings(cache) {
+		t.Fatal("coverings not computed")
+	}
+	if g.ensureCoverings(cache) {
+		t.Error("up-to-date coverings computed again")
+	}
+
+	b, err := cache.Coverings[0].Interior.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded cellUnion
+	err = decoded.UnmarshalJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, cache.Coverings[0].Interior) {
+		t.Errorf("got %v after decoding, want %v", decoded, cache.Coverings[0].Interior)
+	}
+
+	g.coverer.MaxCells = 32
+	if !g.ensureCoverings(cache) {
+		t.Error("coverings not computed again with new parameters")
+	}
+}
+
+func benchmarkLocationFromLatLng(b *testing.B, g *ReverseGeocoder) {
+	points := testPoints(1 << 16)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := points[i%len(points)]
+		g.LocationFromLatLng(p[0], p[1])
+	}
+}
+
+func BenchmarkLocationFromLatLng(b *testing.B) {
+	b.Run("index", func(b *testing.B) {
+		benchmarkLocationFromLatLng(b, testGeocoder())
+	})
+	for _, maxCells := range []int{16, 64, 256} {
+		b.Run(fmt.Sprintf("coverings-%d", maxCells), func(b *testing.B) {
+			benchmarkLocationFromLatLng(b, testGeocoder(WithCoverings(16, maxCells)))
+		})
+	}
+}
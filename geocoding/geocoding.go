@@ -2,15 +2,19 @@ package geocoding
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"hash/crc64"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/golang/geo/s2"
@@ -33,6 +37,19 @@ type Location struct {
 	Region        string `json:",omitempty"`
 	MacroRegion   string `json:",omitempty"`
 	Country       string `json:",omitempty"`
+
+	// LocalityDistance is the distance in kilometres to Locality when it
+	// comes from the nearest locality fallback rather than from a polygon,
+	// nil otherwise. It is 0 on the locality point itself.
+	LocalityDistance *float64 `json:",omitempty"`
+
+	// Timezone is the IANA timezone and UTCOffset its current offset from UTC
+	// (e.g. "+02:00"), only set when timezones are enabled.
+	Timezone  string `json:",omitempty"`
+	UTCOffset string `json:",omitempty"`
+
+	// Places are the places of the location by place type.
+	Places map[string]*Place `json:"-"`
 }
 
 func (l *Location) String() string {
@@ -77,142 +94,588 @@ func (l *Location) String() string {
 	if l.Country != "" {
 		s = append(s, fmt.Sprintf("Country:%s", l.Country))
 	}
+	if l.LocalityDistance != nil {
+		s = append(s, fmt.Sprintf("LocalityDistance:%.2fkm", *l.LocalityDistance))
+	}
+	if l.Timezone != "" {
+		s = append(s, fmt.Sprintf("Timezone:%s", l.Timezone))
+	}
+	if l.UTCOffset != "" {
+		s = append(s, fmt.Sprintf("UTCOffset:%s", l.UTCOffset))
+	}
 
 	return strings.Join(s, " ")
 }
 
+// Filter returns a copy of the location with only the places for which keep
+// returns true.
+func (l *Location) Filter(keep func(p *Place) bool) *Location {
+	res := &Location{
+		Timezone:  l.Timezone,
+		UTCOffset: l.UTCOffset,
+	}
+	for _, p := range l.Places {
+		if keep(p) {
+			res.addPlace(p)
+		}
+	}
+	if res.Locality != "" {
+		res.LocalityDistance = l.LocalityDistance
+	}
+
+	return res
+}
+
+// addPlace adds a place to the location and sets the name of its place type.
+func (l *Location) addPlace(p *Place) {
+	if l.Places == nil {
+		l.Places = make(map[string]*Place)
+	}
+	l.Places[p.PlaceType] = p
+
+	switch p.PlaceType {
+	case "locality":
+		l.Locality = p.Name
+	case "neighbourhood":
+		l.Neighbourhood = p.Name
+	case "borough":
+		l.Borough = p.Name
+	case "microhood":
+		l.Microhood = p.Name
+	case "county":
+		l.County = p.Name
+	case "macrocounty":
+		l.MacroCounty = p.Name
+	case "localadmin":
+		l.LocalAdmin = p.Name
+	case "region":
+		l.Region = p.Name
+	case "macroregion":
+		l.MacroRegion = p.Name
+	case "country":
+		l.Country = p.Name
+	case "campus":
+		l.Campus = p.Name
+	case "marketarea":
+		l.MarketArea = p.Name
+	default:
+		log.Infof("unknown type %q", p.PlaceType)
+	}
+}
+
 // ReverseGeocoder is a reverse geocoder.
+//
+// It is safe for concurrent use: lookups can run while data is loaded or
+// unloaded, they are served from the previous indexes until the new ones are
+// swapped in. Loads and unloads are serialized.
 type ReverseGeocoder struct {
 	index             *s2.ShapeIndex
 	reposFolder       string
 	cacheFolder       string
 	countries         []string
 	enabledPlaceTypes []string
+
+	// nearest locality fallback, nil when disabled
+	localities            *s2.ShapeIndex
+	localityMaxDistanceKm float64
+	geoNamesPath          string
+
+	// timezones layer, nil when disabled
+	timezones     *s2.ShapeIndex
+	timezonesPath string
+
+	// cellCache caches the results of cells, nil when disabled
+	cellCache *cellCache
+
+	// coverer computes the polygon coverings, nil when the covering table is
+	// disabled
+	coverer   *s2.RegionCoverer
+	coverings *coveringTable
+
+	statusMu sync.Mutex
+	status   map[string]CountryStatus
+
+	// indexMu protects the indexes, which are replaced once built so that
+	// queries can run while data is loaded
+	indexMu sync.RWMutex
+
+	// shapes are the loaded shapes of each country, the indexes are built
+	// from them
+	shapesMu sync.Mutex
+	shapes   map[string][]s2.Shape
+	// placeTable stores the places of the shapes, it is compacted when the
+	// indexes are rebuilt
+	placeTable *placeTable
+	// places are the loaded places by id, replaced along with the indexes
+	places map[int64]*Place
+
+	// loadMu serializes the loading and unloading of countries
+	loadMu sync.Mutex
+
+	// loading progress, loadDone are the countries of the current load
+	// that are done
+	loadStartedAt  time.Time
+	loadCountries  int
+	loadDone       map[string]struct{}
+	polygonsLoaded int64
+	ready          int32
+
+	// statistics, see Stats
+	statsMu       sync.Mutex
+	polygonCounts map[string]map[string]int
+	loadDurations map[string]time.Duration
+	lastUpdate    time.Time
+	cacheHits     int64
+	cacheMisses   int64
+	lookups       int64
+	emptyLookups  int64
+
+	coveringHits      int64
+	coveringFallbacks int64
+
+	// workers is the budget of files processed concurrently, shared by all
+	// countries
+	workerCount int
+	workers     chan struct{}
+}
+
+// Option configures optional features of a ReverseGeocoder.
+type Option func(*ReverseGeocoder)
+
+// WithLocalityFallback enables the nearest locality fallback: when no
+// locality polygon contains a location, the closest locality point within
+// maxDistanceKm is used instead.
+// Points come from WOF localities without polygons and, if geoNamesPath is not
+// empty, from a GeoNames cities file (e.g. cities1000.txt).
+func WithLocalityFallback(geoNamesPath string, maxDistanceKm float64) Option {
+	return func(g *ReverseGeocoder) {
+		g.localities = s2.NewShapeIndex()
+		g.localityMaxDistanceKm = maxDistanceKm
+		g.geoNamesPath = geoNamesPath
+	}
+}
+
+// WithTimezones enables timezone lookups from a timezone-boundary-builder
+// geojson release (e.g. combined-with-oceans.json).
+func WithTimezones(path string) Option {
+	return func(g *ReverseGeocoder) {
+		g.timezones = s2.NewShapeIndex()
+		g.timezonesPath = path
+	}
+}
+
+// WithWorkers sets the maximum number of files processed concurrently across
+// all countries, it defaults to GOMAXPROCS.
+func WithWorkers(n int) Option {
+	return func(g *ReverseGeocoder) {
+		if n > 0 {
+			g.workerCount = n
+		}
+	}
 }
 
 // NewReverseGeocoder returns a new geocoder from the given folders, countries and
 // place types. reposFolder is the path to where WOF repos must be cloned,
 // cacheFolder contains the cached version of the processed WOF geojsons.
-func NewReverseGeocoder(reposFolder, cacheFolder string, countries, enabledPlaceTypes []string) *ReverseGeocoder {
-	return &ReverseGeocoder{
+func NewReverseGeocoder(reposFolder, cacheFolder string, countries, enabledPlaceTypes []string, opts ...Option) *ReverseGeocoder {
+	g := &ReverseGeocoder{
 		reposFolder:       reposFolder,
 		cacheFolder:       cacheFolder,
 		countries:         countries,
 		enabledPlaceTypes: enabledPlaceTypes,
 
-		index: s2.NewShapeIndex(),
+		index:  s2.NewShapeIndex(),
+		shapes: make(map[string][]s2.Shape, len(countries)),
+		status: make(map[string]CountryStatus, len(countries)),
+
+		placeTable: newPlaceTable(),
+
+		polygonCounts: make(map[string]map[string]int),
+		loadDurations: make(map[string]time.Duration),
+
+		workerCount: runtime.GOMAXPROCS(0),
 	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.workers = make(chan struct{}, g.workerCount)
+
+	return g
 }
 
 // LocationFromLatLng returns a Location from the given latitude and longitude.
 func (g *ReverseGeocoder) LocationFromLatLng(lat, lng float64) *Location {
-	q := s2.NewContainsPointQuery(g.index, s2.VertexModelOpen)
-	shapes := q.ContainingShapes(s2.PointFromLatLng(s2.LatLngFromDegrees(lat, lng)))
+	res, _ := g.LocationFromLatLngContext(context.Background(), lat, lng)
+	return res
+}
+
+// LocationFromLatLngContext is like LocationFromLatLng, but returns the context
+// error instead of looking up the location when ctx is done.
+func (g *ReverseGeocoder) LocationFromLatLngContext(ctx context.Context, lat, lng float64) (*Location, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	g.indexMu.RLock()
+	defer g.indexMu.RUnlock()
+
+	pt := s2.PointFromLatLng(s2.LatLngFromDegrees(lat, lng))
 
 	var res Location
-	for _, r := range shapes {
-		p := r.(*placePolygon)
-		switch p.Place.PlaceType {
-		case "locality":
-			res.Locality = p.Place.Name
-		case "neighbourhood":
-			res.Neighbourhood = p.Place.Name
-		case "borough":
-			res.Borough = p.Place.Name
-		case "microhood":
-			res.Microhood = p.Place.Name
-		case "county":
-			res.County = p.Place.Name
-		case "macrocounty":
-			res.MacroCounty = p.Place.Name
-		case "localadmin":
-			res.LocalAdmin = p.Place.Name
-		case "region":
-			res.Region = p.Place.Name
-		case "macroregion":
-			res.MacroRegion = p.Place.Name
-		case "country":
-			res.Country = p.Place.Name
-		case "campus":
-			res.Campus = p.Place.Name
-		case "marketarea":
-			res.MarketArea = p.Place.Name
-		default:
-			log.Infof("unknown type %q", p.Place.PlaceType)
-		}
-	}
-	return &res
+	var tz *timezonePolygon
+	if entry := g.cachedCell(pt); entry != nil {
+		for _, p := range entry.places {
+			res.addPlace(p)
+		}
+		tz = entry.timezone
+	} else {
+		if places, ok := g.coveredPlaces(pt); ok {
+			for _, p := range places {
+				res.addPlace(p)
+			}
+		} else {
+			q := s2.NewContainsPointQuery(g.index, s2.VertexModelOpen)
+			for _, r := range q.ContainingShapes(pt) {
+				res.addPlace(g.placeTable.get(r.(*placePolygon).place))
+			}
+		}
+		tz = g.timezone(pt)
+	}
+
+	if res.Locality == "" {
+		if p, dist := g.nearestLocality(pt); p != nil {
+			res.addPlace(g.placeTable.get(p.place))
+			res.LocalityDistance = &dist
+		}
+	}
+
+	res.Timezone, res.UTCOffset = tz.offset()
+
+	atomic.AddInt64(&g.lookups, 1)
+	if len(res.Places) == 0 && res.Timezone == "" {
+		atomic.AddInt64(&g.emptyLookups, 1)
+	}
+
+	return &res, nil
 }
 
 // UpdateAndLoad loads the data into the index.
 // It first clones and updates the countries repositories, and the process all
 // available geojson, using the cache when available.
+// A country failing to load doesn't prevent the others from loading: if a
+// repository can't be updated its existing cache is used. The returned error
+// wraps ErrCountriesFailed if some countries couldn't be loaded, see Status.
 func (g *ReverseGeocoder) UpdateAndLoad() error {
-	for _, c := range g.countries {
-		err := g.loadCountry(c)
+	return g.UpdateAndLoadContext(context.Background())
+}
+
+// UpdateAndLoadContext is like UpdateAndLoad. If ctx is canceled the load is
+// stopped and the previous data, if any, keeps being served.
+func (g *ReverseGeocoder) UpdateAndLoadContext(ctx context.Context) error {
+	return g.loadAll(ctx, func(country string) (LoadState, error) {
+		state, err := g.loadCountry(ctx, country)
 		if err != nil {
-			return fmt.Errorf("error loading country %q: %w", c, err)
+			log.WithError(err).WithField("country", country).Error("error loading country")
 		}
-	}
-	return nil
+		return state, err
+	})
 }
 
 // LoadCachedFiles loads files from the cache folder.
-// The cache should already be populated.
+// The cache should already be populated. When the cache of a country was
+// generated by an incompatible version it is rebuilt from the local
+// repository, which isn't updated.
+// As with UpdateAndLoad, the returned error wraps ErrCountriesFailed if some
+// countries couldn't be loaded.
 func (g *ReverseGeocoder) LoadCachedFiles() error {
-	for _, country := range g.countries {
-		err := filepath.Walk(g.cachePath(country), func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
+	return g.LoadCachedFilesContext(context.Background())
+}
 
-			if !strings.HasSuffix(path, ".geojson") {
-				return nil
-			}
+// LoadCachedFilesContext is like LoadCachedFiles. If ctx is canceled the load
+// is stopped and the previous data, if any, keeps being served.
+func (g *ReverseGeocoder) LoadCachedFilesContext(ctx context.Context) error {
+	return g.loadAll(ctx, func(country string) (LoadState, error) {
+		err := g.loadCachedCountry(ctx, country)
+		if err != nil {
+			log.WithError(err).WithField("country", country).Error("error loading country cache")
+			return LoadStateFailed, err
+		}
+		log.WithField("country", country).Info("loaded country cache")
+		return LoadStateLoaded, nil
+	})
+}
 
-			b, err := os.ReadFile(path)
-			if err != nil {
-				return err
-			}
-			var cache cachedFile
-			err = json.Unmarshal(b, &cache)
-			if err != nil {
-				return err
+// loadAll replaces the data of all countries with the data loaded by load,
+// then loads the layers and rebuilds the indexes. A country that fails to
+// load keeps its previous data, and all countries do if ctx is canceled.
+func (g *ReverseGeocoder) loadAll(ctx context.Context, load func(country string) (LoadState, error)) error {
+	g.loadMu.Lock()
+	defer g.loadMu.Unlock()
+
+	countries := g.countriesList()
+	g.startLoading(countries)
+	defer g.setReady()
+
+	g.shapesMu.Lock()
+	previous := g.shapes
+	g.shapes = make(map[string][]s2.Shape, len(previous))
+	g.shapesMu.Unlock()
+
+	g.forEachCountry(ctx, countries, func(c string) {
+		state, err := load(c)
+		if state == LoadStateFailed {
+			// the GeoNames localities are added back by loadLayers
+			g.shapesMu.Lock()
+			g.shapes[c] = g.withoutGeoNames(previous[c])
+			g.shapesMu.Unlock()
+			if len(previous[c]) > 0 {
+				state = LoadStateStale
 			}
-			if !g.placeTypeEnabled(cache.Place.PlaceType) {
-				return nil
+		}
+		g.setStatus(c, state, err)
+	})
+
+	err := ctx.Err()
+	if err == nil {
+		err = g.loadLayers(ctx)
+	}
+	if err != nil && ctx.Err() != nil {
+		// the indexes still serve the previous data
+		g.shapesMu.Lock()
+		g.shapes = previous
+		g.shapesMu.Unlock()
+		for _, c := range countries {
+			state := LoadStateFailed
+			if len(previous[c]) > 0 {
+				state = LoadStateStale
 			}
+			g.setStatus(c, state, ctx.Err())
+			g.recountPolygons(c)
+		}
+		return fmt.Errorf("load canceled: %w", ctx.Err())
+	}
+	for _, c := range countries {
+		g.recountPolygons(c)
+	}
+	if err != nil {
+		return err
+	}
+	g.rebuildIndexes()
+
+	return g.failedCountriesError()
+}
+
+// forEachCountry calls f for the given countries concurrently, countries are
+// not started anymore once ctx is done. Countries share the workers budget so
+// at most workerCount countries are started at once.
+func (g *ReverseGeocoder) forEachCountry(ctx context.Context, countries []string, f func(country string)) {
+	sem := make(chan struct{}, g.workerCount)
+
+	var wg sync.WaitGroup
+	for _, c := range countries {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(c string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			start := time.Now()
+			f(c)
+			g.setLoadDuration(c, time.Since(start))
+		}(c)
+	}
+	wg.Wait()
+}
+
+func (g *ReverseGeocoder) loadCachedCountry(ctx context.Context, country string) error {
+	upToDate, err := g.cacheUpToDate(country)
+	if err != nil {
+		return fmt.Errorf("error reading cache manifest: %w", err)
+	}
+	if !upToDate {
+		// the cache can only be rebuilt from an existing repository
+		if _, err := os.Stat(g.repoPath(country)); err != nil {
+			return fmt.Errorf("cache is outdated and the repository is not available")
+		}
+		log.WithField("country", country).Warn("cache is outdated, rebuilding it from the repository")
+		err := g.indexCountry(ctx, country)
+		if err != nil {
+			return fmt.Errorf("error rebuilding cache: %w", err)
+		}
+		return nil
+	}
 
-			for _, p := range cache.PlacePolygons() {
-				g.index.Add(p)
+	return g.loadCountryCache(ctx, country)
+}
+
+// loadCountryCache loads all the cache files of a country into the index, it
+// stops when ctx is done.
+func (g *ReverseGeocoder) loadCountryCache(ctx context.Context, country string) error {
+	pathsChan := make(chan string, g.workerCount)
+
+	var wg sync.WaitGroup
+	for i := 0; i < g.workerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for path := range pathsChan {
+				if ctx.Err() != nil {
+					continue
+				}
+				g.workers <- struct{}{}
+				cache := g.readCountryCacheFile(country, path)
+				<-g.workers
+
+				if cache == nil {
+					continue
+				}
+				g.addCachedFile(country, cache)
 			}
+		}()
+	}
 
+	err := filepath.Walk(g.cachePath(country), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if strings.HasSuffix(path, ".geojson") {
+			pathsChan <- path
+		}
+
+		return nil
+	})
+	close(pathsChan)
+	wg.Wait()
+
+	if err == nil {
+		// files were skipped
+		err = ctx.Err()
+	}
+
+	return err
+}
+
+// readCountryCacheFile reads a cache file of a country, recovering it if it is
+// corrupt. It returns nil if the file must not be loaded.
+func (g *ReverseGeocoder) readCountryCacheFile(country, path string) *cachedFile {
+	cache, err := readCacheFile(path)
+	if err != nil {
+		log.WithError(err).WithField("path", path).Warn("corrupt cache file")
+		cache = g.recoverCacheFile(country, path)
+		if cache == nil {
 			return nil
+		}
+	} else {
+		atomic.AddInt64(&g.cacheHits, 1)
+	}
+	if !g.placeTypeEnabled(cache.Place.PlaceType) {
+		return nil
+	}
+	if g.sourceDeleted(country, cache) {
+		return nil
+	}
+	if g.ensureCoverings(cache) {
+		err := writeFileAtomic(path, func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(cache)
 		})
 		if err != nil {
-			return fmt.Errorf("error loading %q: %w", country, err)
+			log.WithError(err).WithField("path", path).Warn("error writing coverings to the cache")
 		}
-		log.WithField("country", country).Info("loaded country cache")
 	}
 
-	return nil
+	return cache
+}
+
+// addCachedFile adds the place of a cache file and its shapes to the loaded
+// shapes of a country if its place type is enabled, it is only served once the
+// indexes are rebuilt. The place is stored once in the place table, its
+// polygons reference it by index. It is safe to call concurrently.
+func (g *ReverseGeocoder) addCachedFile(country string, c *cachedFile) {
+	g.shapesMu.Lock()
+	defer g.shapesMu.Unlock()
+
+	if !g.placeTypeEnabled(c.Place.PlaceType) {
+		return
+	}
+	point := c.Point != nil && g.localities != nil
+	if len(c.Polygons) == 0 && !point {
+		return
+	}
+
+	place := c.Place
+	place.polygons = c.Polygons
+	i := g.placeTable.add(place)
+
+	for j, p := range c.Polygons {
+		pp := &placePolygon{
+			Polygon: p,
+			place:   i,
+		}
+		if len(c.Coverings) == len(c.Polygons) {
+			pp.covering = c.Coverings[j]
+		}
+		g.shapes[country] = append(g.shapes[country], pp)
+		atomic.AddInt64(&g.polygonsLoaded, 1)
+		g.countPolygon(country, place.PlaceType)
+	}
+	if point {
+		g.shapes[country] = append(g.shapes[country], newPlacePoint(*c.Point, i))
+	}
 }
 
-func (g *ReverseGeocoder) loadCountry(country string) error {
-	err := g.cloneAndUpdateRepository(country)
+// loadLayers loads the optional layers that are not tied to a country.
+func (g *ReverseGeocoder) loadLayers(ctx context.Context) error {
+	err := g.loadLocalityFallback(g.countriesList())
 	if err != nil {
-		return fmt.Errorf("error updating repository: %w", err)
+		return err
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return g.loadTimezones()
+}
 
-	err = g.indexCountry(country)
+// loadCountry updates and indexes a country. If the repository can't be
+// updated but a cache exists, the cache is loaded and the state is stale.
+func (g *ReverseGeocoder) loadCountry(ctx context.Context, country string) (LoadState, error) {
+	err := g.cloneAndUpdateRepository(ctx, country)
 	if err != nil {
-		return fmt.Errorf("error indexing country: %w", err)
+		err = fmt.Errorf("error updating repository: %w", err)
+		if ctx.Err() != nil {
+			return LoadStateFailed, err
+		}
+
+		upToDate, cacheErr := g.cacheUpToDate(country)
+		if cacheErr != nil || !upToDate {
+			return LoadStateFailed, err
+		}
+
+		log.WithError(err).WithField("country", country).Warn("using existing cache")
+		cacheErr = g.loadCountryCache(ctx, country)
+		if cacheErr != nil {
+			return LoadStateFailed, fmt.Errorf("%v, error loading cache: %w", err, cacheErr)
+		}
+		return LoadStateStale, err
 	}
 
-	return nil
+	err = g.indexCountry(ctx, country)
+	if err != nil {
+		return LoadStateFailed, fmt.Errorf("error indexing country: %w", err)
+	}
+
+	return LoadStateLoaded, nil
 }
 
-func (g *ReverseGeocoder) cloneAndUpdateRepository(country string) error {
+func (g *ReverseGeocoder) cloneAndUpdateRepository(ctx context.Context, country string) error {
 	if err := g.createReposFolder(); err != nil {
 		return fmt.Errorf("could not create repos folder: %w", err)
 	}
@@ -232,7 +695,7 @@ func (g *ReverseGeocoder) cloneAndUpdateRepository(country string) error {
 	gitURL := fmt.Sprintf("https://github.com/whosonfirst-data/whosonfirst-data-admin-%s.git", country)
 	log.WithField("repository", gitURL).Info("cloning repository")
 	if os.IsNotExist(err) {
-		cmd := exec.Command("git", "clone", gitURL, repoPath)
+		cmd := exec.CommandContext(ctx, "git", "clone", gitURL, repoPath)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		err := cmd.Run()
@@ -242,7 +705,7 @@ func (g *ReverseGeocoder) cloneAndUpdateRepository(country string) error {
 	}
 
 	log.WithField("country", country).Info("updating repository")
-	cmd := exec.Command("git", "pull", "--ff-only")
+	cmd := exec.CommandContext(ctx, "git", "pull", "--ff-only")
 	cmd.Dir = repoPath
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -256,22 +719,63 @@ func (g *ReverseGeocoder) cloneAndUpdateRepository(country string) error {
 
 var crcTable = crc64.MakeTable(crc64.ISO)
 
-// indexCountry iterates over all geojson files for a country and add them to the index.
-// If an up-to-date cached version exists indexCountry loads it, otherwise it
-// processes the source file and creates a cache file.
-func (g *ReverseGeocoder) indexCountry(country string) error {
-	repoPath := g.repoPath(country)
-
-	log.WithField("country", country).Info("processing country files, this might take a while...")
-
+// indexCountry updates the cache of a country from its repository and loads
+// it into the index.
+// When the cache was built from a previous commit only the files changed since
+// are processed, otherwise all files are.
+func (g *ReverseGeocoder) indexCountry(ctx context.Context, country string) error {
 	err := g.createCacheFolder(country)
 	if err != nil {
 		return fmt.Errorf("could not create cache directory: %w", err)
 	}
 
-	concurrent := runtime.GOMAXPROCS(0)
+	err = g.checkCacheManifest(country)
+	if err != nil {
+		return fmt.Errorf("error checking cache manifest: %w", err)
+	}
+
+	head, err := g.repoHead(ctx, country)
+	if err != nil {
+		log.WithError(err).WithField("country", country).Warn("could not get repository head commit")
+	}
+
+	if head != "" {
+		ok, err := g.indexChangedFiles(ctx, country, head)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+
+	failed, err := g.indexAllFiles(ctx, country)
+	if err != nil {
+		return err
+	}
+
+	if head != "" && failed == 0 {
+		return g.setIndexedCommit(country, head)
+	}
+
+	// all files are processed again next time, retrying the failed ones
+	return g.writeCacheManifest(country, currentCacheManifest())
+}
+
+// indexAllFiles iterates over all geojson files for a country and add them to the index.
+// If an up-to-date cached version exists indexAllFiles loads it, otherwise it
+// processes the source file and creates a cache file.
+// It returns the number of files that couldn't be processed, and stops when
+// ctx is done.
+func (g *ReverseGeocoder) indexAllFiles(ctx context.Context, country string) (int, error) {
+	repoPath := g.repoPath(country)
+
+	log.WithField("country", country).Info("processing country files, this might take a while...")
+
+	var failed int64
+	concurrent := g.workerCount
 	filesChan := make(chan string, concurrent)
-	polygonChan := make(chan *placePolygon, concurrent)
+	cacheChan := make(chan *cachedFile, concurrent)
 
 	// start geojson workers
 	var filesWG sync.WaitGroup
@@ -281,29 +785,23 @@ func (g *ReverseGeocoder) indexCountry(country string) error {
 			defer filesWG.Done()
 
 			for path := range filesChan {
-				cache, err := g.loadCachedPolygons(country, path)
-				if err != nil {
-					log.WithError(err).Error("error loading cached polygon: %w", err)
-					continue
-				}
-				if cache != nil {
-					if !cache.Valid {
-						continue
-					}
-					for _, p := range cache.PlacePolygons() {
-						polygonChan <- p
-					}
+				if ctx.Err() != nil {
 					continue
 				}
+				g.workers <- struct{}{}
+				cache, err := g.cachedOrProcessed(country, path)
+				<-g.workers
 
-				polygons, err := g.processGeojson(country, path)
 				if err != nil {
-					log.WithError(err).Error("error processing geojson %q", path)
+					log.WithError(err).Error("error indexing file")
+					atomic.AddInt64(&failed, 1)
 					continue
 				}
-				for _, p := range polygons {
-					polygonChan <- p
+				if cache == nil || !cache.Valid {
+					continue
 				}
+
+				cacheChan <- cache
 			}
 		}()
 	}
@@ -315,45 +813,84 @@ func (g *ReverseGeocoder) indexCountry(country string) error {
 		defer polygonWG.Done()
 
 		var count int
-		for p := range polygonChan {
-			count++
-			if count%1000 == 0 {
-				log.WithField("country", country).Infof("loaded %d polygons", count)
-			}
-
-			if !g.placeTypeEnabled(p.Place.PlaceType) {
-				continue
+		for cache := range cacheChan {
+			for range cache.Polygons {
+				count++
+				if count%1000 == 0 {
+					log.WithField("country", country).Infof("loaded %d polygons", count)
+				}
 			}
 
-			g.index.Add(p)
+			g.addCachedFile(country, cache)
 		}
 	}()
 
-	err = filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
+	cacheFiles := make(map[string]struct{})
+	err := filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		if !strings.HasSuffix(path, ".geojson") {
 			return nil
 		}
 
+		cacheFiles[filepath.Clean(g.cacheFile(country, path))] = struct{}{}
 		filesChan <- path
 
 		return nil
 	})
 	close(filesChan)
 
+	filesWG.Wait()
+	close(cacheChan)
+
+	polygonWG.Wait()
+
+	if err == nil {
+		// files were skipped
+		err = ctx.Err()
+	}
 	if err != nil {
-		return fmt.Errorf("error processing country files: %w", err)
+		return 0, fmt.Errorf("error processing country files: %w", err)
 	}
 
-	filesWG.Wait()
-	close(polygonChan)
+	// all source files have been seen, remaining cache files are orphans
+	_, err = g.pruneCache(country, cacheFiles, false)
+	if err != nil {
+		log.WithError(err).WithField("country", country).Error("error pruning cache")
+	}
 
-	polygonWG.Wait()
+	return int(failed), nil
+}
 
-	return nil
+// cachedOrProcessed returns the cached version of a source file, processing
+// the source if the cache is missing or outdated.
+func (g *ReverseGeocoder) cachedOrProcessed(country, path string) (*cachedFile, error) {
+	cache, err := g.loadCachedPolygons(country, path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading cached polygon %q: %w", path, err)
+	}
+	if cache != nil {
+		if g.ensureCoverings(cache) {
+			err := g.writeCache(country, path, cache)
+			if err != nil {
+				log.WithError(err).WithField("path", path).Warn("error writing coverings to the cache")
+			}
+		}
+		return cache, nil
+	}
+
+	cache, err = g.processGeojson(country, path)
+	if err != nil {
+		return nil, fmt.Errorf("error processing geojson %q: %w", path, err)
+	}
+
+	return cache, nil
 }
 
 func fileHash(path string) (string, error) {
@@ -373,14 +910,14 @@ func (g *ReverseGeocoder) loadCachedPolygons(country, path string) (*cachedFile,
 		return nil, err
 	}
 
-	b, err := os.ReadFile(cachePath)
-	if err != nil {
-		return nil, err
-	}
-	var cache cachedFile
-	err = json.Unmarshal(b, &cache)
+	cache, err := readCacheFile(cachePath)
 	if err != nil {
-		return nil, err
+		// the source will be processed again
+		log.WithError(err).WithField("path", cachePath).Warn("corrupt cache file")
+		if err := g.quarantineCacheFile(country, cachePath); err != nil {
+			log.WithError(err).Error("error quarantining cache file")
+		}
+		return nil, nil
 	}
 	hash, err := fileHash(path)
 	if err != nil {
@@ -391,13 +928,17 @@ func (g *ReverseGeocoder) loadCachedPolygons(country, path string) (*cachedFile,
 		// file has changed
 		return nil, nil
 	}
+	atomic.AddInt64(&g.cacheHits, 1)
 
-	return &cache, nil
+	return cache, nil
 }
 
-// processGeojson reads the given geojson file and returns a list of simplified
-// polygons.
-func (g *ReverseGeocoder) processGeojson(country, path string) ([]*placePolygon, error) {
+// processGeojson reads the given geojson file, writes its cached version and
+// returns it. Polygons are simplified, localities without polygons keep their
+// point.
+func (g *ReverseGeocoder) processGeojson(country, path string) (*cachedFile, error) {
+	atomic.AddInt64(&g.cacheMisses, 1)
+
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("error reading file: %w", err)
@@ -420,6 +961,15 @@ func (g *ReverseGeocoder) processGeojson(country, path string) ([]*placePolygon,
 		return nil, nil
 	}
 
+	if feature.Geometry.IsPoint() && placeType == "locality" {
+		pt := s2.PointFromLatLng(s2.LatLngFromDegrees(feature.Geometry.Point[1], feature.Geometry.Point[0]))
+		return g.writeProcessed(country, path, &cachedFile{
+			Valid: true,
+			Place: placeFromFeature(feature, name, placeType),
+			Point: &pt,
+		})
+	}
+
 	if !feature.Geometry.IsPolygon() && !feature.Geometry.IsMultiPolygon() {
 		return nil, g.cacheInvalid(country, path)
 	}
@@ -431,7 +981,6 @@ func (g *ReverseGeocoder) processGeojson(country, path string) ([]*placePolygon,
 		srcPolygons = [][][][]float64{feature.Geometry.Polygon}
 	}
 
-	var res []*placePolygon
 	var polygons []*s2.Polygon
 	for _, p := range srcPolygons {
 		s2p, err := convertToS2Polygon(p)
@@ -441,45 +990,38 @@ func (g *ReverseGeocoder) processGeojson(country, path string) ([]*placePolygon,
 		}
 		if s2p != nil {
 			polygons = append(polygons, s2p)
-			res = append(res, &placePolygon{
-				Polygon: s2p,
-				Place: place{
-					Name:      name,
-					PlaceType: placeType,
-				},
-			})
 		}
 	}
 
+	return g.writeProcessed(country, path, &cachedFile{
+		Valid:    true,
+		Place:    placeFromFeature(feature, name, placeType),
+		Polygons: polygons,
+	})
+}
+
+// writeProcessed sets the source hash of the given cache and writes it.
+func (g *ReverseGeocoder) writeProcessed(country, path string, cache *cachedFile) (*cachedFile, error) {
 	hash, err := fileHash(path)
 	if err != nil {
 		return nil, fmt.Errorf("could not get file hash: %w", err)
 	}
+	cache.Hash = hash
+	g.ensureCoverings(cache)
 
-	err = g.writeCache(country, path, &cachedFile{
-		Hash:  hash,
-		Valid: true,
-		Place: place{
-			Name:      name,
-			PlaceType: placeType,
-		},
-		Polygons: polygons,
-	})
+	err = g.writeCache(country, path, cache)
 	if err != nil {
 		return nil, fmt.Errorf("error writing cache: %w", err)
 	}
 
-	return res, nil
+	return cache, nil
 }
 
 func convertToS2Polygon(p [][][]float64) (*s2.Polygon, error) {
 	loops := make([]*s2.Loop, 0, len(p))
 	for _, x := range p {
 		loop := toLoop(x)
-		threshold := 0.0001
-		minPointsToKeep := 0
-		avoidIntersections := true
-		loop, err := geosimplification.SimplifyLoop(loop, threshold, minPointsToKeep, avoidIntersections)
+		loop, err := geosimplification.SimplifyLoop(loop, simplifyThreshold, simplifyMinPointsToKeep, simplifyAvoidIntersections)
 		if err != nil {
 			return nil, fmt.Errorf("error simplifying loop: %w", err)
 		}
@@ -489,9 +1031,9 @@ func convertToS2Polygon(p [][][]float64) (*s2.Polygon, error) {
 	res := s2.PolygonFromLoops(loops)
 	// if the area is huge it usually means the polygon is inverted, so try to
 	// invert it and if it's still huge skip it...
-	if res.RectBound().Area() > 10 {
+	if res.RectBound().Area() > maxPolygonBoundArea {
 		res.Invert()
-		if res.RectBound().Area() > 10 {
+		if res.RectBound().Area() > maxPolygonBoundArea {
 			return nil, nil
 		}
 	}
@@ -528,13 +1070,17 @@ func (g *ReverseGeocoder) cacheInvalid(country, path string) error {
 }
 
 func (g *ReverseGeocoder) writeCache(country, path string, cache *cachedFile) error {
-	f, err := os.Create(g.cacheFile(country, path))
+	cache.Source = g.sourcePath(country, path)
+
+	cachePath := g.cacheFile(country, path)
+	err := os.MkdirAll(filepath.Dir(cachePath), 0755)
 	if err != nil {
-		return fmt.Errorf("unable to create cache file: %w", err)
+		return fmt.Errorf("unable to create cache directory: %w", err)
 	}
-	defer f.Close()
 
-	return json.NewEncoder(f).Encode(cache)
+	return writeFileAtomic(cachePath, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(cache)
+	})
 }
 
 func (g *ReverseGeocoder) cachePath(country string) string {
@@ -545,8 +1091,10 @@ func (g *ReverseGeocoder) repoPath(country string) string {
 	return fmt.Sprintf("%s/%s", g.reposFolder, country)
 }
 
+// cacheFile returns the cache file of a source file, its path relative to the
+// cache folder is the same as the source path relative to the repository.
 func (g *ReverseGeocoder) cacheFile(country, path string) string {
-	return fmt.Sprintf("%s/%s/%s", g.cacheFolder, country, filepath.Base(path))
+	return filepath.Join(g.cachePath(country), filepath.FromSlash(g.sourcePath(country, path)))
 }
 
 func (g *ReverseGeocoder) placeTypeEnabled(placetype string) bool {
@@ -577,14 +1125,13 @@ func toLoop(points [][]float64) *s2.Loop {
 	return s2.LoopFromPoints(pts)
 }
 
-type place struct {
-	Name      string
-	PlaceType string
-}
-
 type placePolygon struct {
 	*s2.Polygon
-	Place place
+	// place is the index of the place in the place table
+	place uint32
+
+	// covering is nil when the covering table is disabled
+	covering *polygonCovering
 }
 
 type polygons []*s2.Polygon
@@ -622,20 +1169,17 @@ func (p *polygons) UnmarshalJSON(data []byte) error {
 }
 
 type cachedFile struct {
+	// Source is the path of the source file, relative to the country
+	// repository.
+	Source   string `json:",omitempty"`
 	Hash     string
 	Valid    bool
-	Place    place
+	Place    Place
 	Polygons polygons
-}
+	Point    *s2.Point `json:",omitempty"`
 
-func (c *cachedFile) PlacePolygons() []*placePolygon {
-	res := make([]*placePolygon, 0, len(c.Polygons))
-	for _, p := range c.Polygons {
-		res = append(res, &placePolygon{
-			Polygon: p,
-			Place:   c.Place,
-		})
-	}
-
-	return res
+	// Coverings are the coverings of the polygons, when the covering table is
+	// enabled
+	Coverings      []*polygonCovering `json:",omitempty"`
+	CoveringParams *coveringParams    `json:",omitempty"`
 }
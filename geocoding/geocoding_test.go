@@ -0,0 +1,391 @@
+package geocoding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// writeTestCache writes the polygons of testGeocoder as the cache of country
+// xx in cacheFolder.
+func writeTestCache(t *testing.T, cacheFolder string) {
+	t.Helper()
+
+	g := NewReverseGeocoder("", cacheFolder, []string{"xx"}, nil)
+	err := g.createCacheFolder("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.writeCacheManifest("xx", currentCacheManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := testGeocoder()
+	for i, s := range src.shapes["xx"] {
+		p := s.(*placePolygon)
+		b, err := json.Marshal(&cachedFile{
+			Valid:    true,
+			Place:    *src.placeTable.get(p.place),
+			Polygons: polygons{p.Polygon},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(g.cachePath("xx"), fmt.Sprintf("%d.geojson", i)), b, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConcurrentLoadAndLookup(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCache(t, dir)
+	polygons := len(testGeocoder().shapes["xx"])
+
+	g := NewReverseGeocoder("", dir, []string{"xx"}, nil, WithCellCache(12, 100), WithCoverings(16, 64), WithLocalityFallback("", 10))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			points := testPoints(1000 * (i + 1))
+			for n := 0; ctx.Err() == nil; n++ {
+				p := points[n%len(points)]
+				_, err := g.LocationFromLatLngContext(ctx, p[0], p[1])
+				if err != nil && !errors.Is(err, context.Canceled) {
+					t.Errorf("unexpected error: %v", err)
+				}
+				g.Stats()
+				g.Status()
+			}
+		}(i)
+	}
+
+	for i := 0; i < 3; i++ {
+		err := g.LoadCachedFilesContext(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.UnloadCountry("xx")
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.addCountry("xx")
+	}
+	err := g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	wg.Wait()
+
+	if loc := g.LocationFromLatLng(45, 5); loc.Country != "country 1" {
+		t.Errorf("got country %q, want %q", loc.Country, "country 1")
+	}
+	var loaded int
+	for _, n := range g.Stats().Polygons["xx"] {
+		loaded += n
+	}
+	if loaded != polygons {
+		t.Errorf("got %d polygons after reloading, want %d", loaded, polygons)
+	}
+}
+
+// writeTestCaches writes the cache of writeTestCache for each of the given
+// countries in cacheFolder. It returns the number of files per country.
+func writeTestCaches(t *testing.T, cacheFolder string, countries []string) int {
+	t.Helper()
+
+	src := filepath.Join(t.TempDir(), "xx")
+	writeTestCache(t, filepath.Dir(src))
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files int
+	for _, c := range countries {
+		err := os.MkdirAll(filepath.Join(cacheFolder, c), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = 0
+		for _, e := range entries {
+			b, err := os.ReadFile(filepath.Join(src, e.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.WriteFile(filepath.Join(cacheFolder, c, e.Name()), b, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filepath.Ext(e.Name()) == ".geojson" {
+				files++
+			}
+		}
+	}
+
+	return files
+}
+
+func TestWorkerBudget(t *testing.T) {
+	countries := []string{"aa", "bb", "cc", "dd", "ee"}
+	dir := t.TempDir()
+	files := int64(len(countries) * writeTestCaches(t, dir, countries))
+
+	const workers = 2
+	g := NewReverseGeocoder("", dir, countries, nil, WithWorkers(workers))
+
+	// hold the whole budget, no country can read its files
+	for i := 0; i < workers; i++ {
+		g.workers <- struct{}{}
+	}
+	var mu sync.Mutex
+	var running, maxRunning int
+	done := make(chan error)
+	go func() {
+		done <- g.loadAll(context.Background(), func(country string) (LoadState, error) {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				running--
+				mu.Unlock()
+			}()
+
+			err := g.loadCachedCountry(context.Background(), country)
+			if err != nil {
+				return LoadStateFailed, err
+			}
+			return LoadStateLoaded, nil
+		})
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("load done without any worker: %v", err)
+	default:
+	}
+	if hits := g.Stats().CacheHits; hits != 0 {
+		t.Errorf("got %d cache files read without any worker, want 0", hits)
+	}
+
+	for i := 0; i < workers; i++ {
+		<-g.workers
+	}
+	err := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits := g.Stats().CacheHits; hits != files {
+		t.Errorf("got %d cache files read, want %d", hits, files)
+	}
+	if maxRunning < 1 || maxRunning > workers {
+		t.Errorf("got %d countries loaded at once, want at most %d", maxRunning, workers)
+	}
+}
+
+func TestWorkerBudgetSameIndex(t *testing.T) {
+	countries := []string{"aa", "bb", "cc"}
+	dir := t.TempDir()
+	writeTestCaches(t, dir, countries)
+
+	load := func(workers int) *ReverseGeocoder {
+		g := NewReverseGeocoder("", dir, countries, nil, WithWorkers(workers))
+		err := g.LoadCachedFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return g
+	}
+	serial, concurrent := load(1), load(8)
+
+	if got, want := concurrent.Stats().Polygons, serial.Stats().Polygons; !reflect.DeepEqual(got, want) {
+		t.Errorf("got polygons %v with 8 workers, want %v as with 1", got, want)
+	}
+	for _, p := range testPoints(200) {
+		got, want := concurrent.LocationFromLatLng(p[0], p[1]), serial.LocationFromLatLng(p[0], p[1])
+		if !reflect.DeepEqual(withoutPolygons(*got), withoutPolygons(*want)) {
+			t.Errorf("%v: got %v with 8 workers, want %v as with 1", p, got, want)
+		}
+	}
+}
+
+func TestPlacesShared(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCache(t, dir)
+	places := len(testGeocoder().shapes["xx"])
+
+	// a place with two polygons
+	src := testGeocoder()
+	b, err := json.Marshal(&cachedFile{
+		Valid: true,
+		Place: Place{ID: 1000, Name: "locality 1000", PlaceType: "locality", Country: "XX"},
+		Polygons: polygons{
+			src.shapes["xx"][2].(*placePolygon).Polygon,
+			src.shapes["xx"][4].(*placePolygon).Polygon,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "xx", "multi.geojson"), b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	places++
+
+	stringData := func(s string) uintptr {
+		return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+	}
+
+	g := NewReverseGeocoder("", dir, []string{"xx"}, nil)
+	for i := 0; i < 2; i++ {
+		err := g.LoadCachedFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// reloading doesn't keep the previous places
+		if n := g.placeTable.len(); n != places {
+			t.Errorf("load %d: got %d places in the table, want %d", i, n, places)
+		}
+
+		var multi []uint32
+		placeTypes := make(map[string]uintptr)
+		for _, s := range g.shapes["xx"] {
+			p := s.(*placePolygon)
+			place := g.placeTable.get(p.place)
+			if place.ID == 1000 {
+				multi = append(multi, p.place)
+			}
+			if data, ok := placeTypes[place.PlaceType]; ok && data != stringData(place.PlaceType) {
+				t.Errorf("load %d: place type %q not shared", i, place.PlaceType)
+			}
+			placeTypes[place.PlaceType] = stringData(place.PlaceType)
+		}
+		if len(multi) != 2 || multi[0] != multi[1] {
+			t.Errorf("load %d: got place indexes %v for the polygons of a place, want the same index twice", i, multi)
+		}
+		if len(multi) > 0 && g.PlaceByID(1000) != g.placeTable.get(multi[0]) {
+			t.Errorf("load %d: place by id not shared with its polygons", i)
+		}
+	}
+
+	err = g.UnloadCountry("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := g.placeTable.len(); n != 0 {
+		t.Errorf("got %d places in the table after unloading, want 0", n)
+	}
+}
+
+func TestLoadCachedFilesCanceled(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCache(t, dir)
+
+	g := NewReverseGeocoder("", dir, []string{"xx"}, nil)
+	err := g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = g.LoadCachedFilesContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+
+	// the previous data is still served
+	if loc := g.LocationFromLatLng(45, 5); loc.Country != "country 1" {
+		t.Errorf("got country %q, want %q", loc.Country, "country 1")
+	}
+	if s := g.Status()[0]; s.State != LoadStateStale {
+		t.Errorf("got state %v, want %v", s.State, LoadStateStale)
+	}
+
+	g = NewReverseGeocoder("", dir, []string{"xx"}, nil)
+	err = g.LoadCachedFilesContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if g.Loaded("xx") {
+		t.Error("country loaded after cancellation")
+	}
+}
+
+func TestLocationFromLatLngContextCanceled(t *testing.T) {
+	g := testGeocoder()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	loc, err := g.LocationFromLatLngContext(ctx, 45, 5)
+	if err != nil || loc.Country != "country 1" {
+		t.Errorf("got %v, %v", loc, err)
+	}
+
+	cancel()
+	_, err = g.LocationFromLatLngContext(ctx, 45, 5)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestProgressReload(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCache(t, dir)
+
+	g := NewReverseGeocoder("", dir, []string{"xx"}, nil)
+	if p := g.Progress(); p.Ready || p.CountriesDone != 0 || p.CountriesTotal != 1 {
+		t.Errorf("got progress %+v before loading", p)
+	}
+	err := g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := g.Progress(); !p.Ready || p.CountriesDone != 1 || p.CountriesTotal != 1 {
+		t.Errorf("got progress %+v after loading", p)
+	}
+
+	// reloading starts over while the country stays loaded
+	var during Progress
+	err = g.loadAll(context.Background(), func(country string) (LoadState, error) {
+		during = g.Progress()
+		if !g.Loaded(country) {
+			t.Error("country not loaded while reloading")
+		}
+		return LoadStateLoaded, g.loadCachedCountry(context.Background(), country)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if during.CountriesDone != 0 || during.CountriesTotal != 1 {
+		t.Errorf("got progress %+v while reloading", during)
+	}
+	if p := g.Progress(); p.CountriesDone != 1 || p.CountriesTotal != 1 {
+		t.Errorf("got progress %+v after reloading", p)
+	}
+}
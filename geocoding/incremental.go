@@ -0,0 +1,198 @@
+package geocoding
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fileChange is a file added, modified or deleted between two commits.
+type fileChange struct {
+	// Status is the git status letter: A, M, T or D.
+	Status string
+	Path   string
+}
+
+// repoHead returns the commit checked out in a country repository.
+func (g *ReverseGeocoder) repoHead(ctx context.Context, country string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
+	cmd.Dir = g.repoPath(country)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error running git rev-parse: %w", err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// changedFiles returns the geojson files changed in a country repository
+// between two commits.
+func (g *ReverseGeocoder) changedFiles(ctx context.Context, country, from, to string) ([]fileChange, error) {
+	repoPath := g.repoPath(country)
+
+	cmd := exec.CommandContext(ctx, "git", "diff", "--name-status", "--no-renames", "-z", from, to)
+	cmd.Dir = repoPath
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running git diff: %w", err)
+	}
+
+	// with -z each entry is "<status>\0<path>\0"
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if len(fields) == 1 && fields[0] == "" {
+		return nil, nil
+	}
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("unexpected git diff output")
+	}
+
+	var res []fileChange
+	for i := 0; i < len(fields); i += 2 {
+		status, path := fields[i], fields[i+1]
+		switch status {
+		case "A", "M", "T", "D":
+		default:
+			return nil, fmt.Errorf("unexpected status %q for %q", status, path)
+		}
+
+		if !strings.HasSuffix(path, ".geojson") {
+			continue
+		}
+
+		res = append(res, fileChange{
+			Status: status,
+			Path:   filepath.Join(repoPath, filepath.FromSlash(path)),
+		})
+	}
+
+	return res, nil
+}
+
+// indexChangedFiles updates the cache of a country with the files changed
+// since the last indexed commit, then loads the country cache into the index.
+// It returns false if the changes can't be determined, in which case all
+// files must be processed.
+func (g *ReverseGeocoder) indexChangedFiles(ctx context.Context, country, head string) (bool, error) {
+	logger := log.WithField("country", country)
+
+	manifest, err := g.readCacheManifest(country)
+	if err != nil || manifest == nil || manifest.Commit == "" {
+		return false, nil
+	}
+	if manifest.PlaceTypes != g.placeTypesKey() {
+		// files of newly enabled place types were never cached
+		logger.Info("enabled place types changed, processing all files")
+		return false, nil
+	}
+
+	changes, err := g.changedFiles(ctx, country, manifest.Commit, head)
+	if err != nil {
+		if ctx.Err() != nil {
+			return true, ctx.Err()
+		}
+		logger.WithError(err).Warn("could not get changed files, processing all files")
+		return false, nil
+	}
+
+	logger.Infof("processing %d files changed since %s", len(changes), manifest.Commit)
+	failed := g.applyChanges(ctx, country, changes)
+	if err := ctx.Err(); err != nil {
+		// the manifest commit is kept so that the changes are applied again
+		return true, err
+	}
+
+	err = g.loadCountryCache(ctx, country)
+	if err != nil {
+		return true, fmt.Errorf("error loading cache: %w", err)
+	}
+
+	if failed > 0 {
+		// keep the previous commit so that the changes are applied again
+		logger.Warnf("%d changed files couldn't be processed", failed)
+		return true, nil
+	}
+
+	return true, g.setIndexedCommit(country, head)
+}
+
+// applyChanges updates the cache files of the given changes and returns the
+// number of files that couldn't be processed. It stops when ctx is done.
+func (g *ReverseGeocoder) applyChanges(ctx context.Context, country string, changes []fileChange) int {
+	var failed int64
+
+	concurrent := g.workerCount
+	changesChan := make(chan fileChange, concurrent)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for c := range changesChan {
+				if ctx.Err() != nil {
+					continue
+				}
+				g.workers <- struct{}{}
+				err := g.applyChange(country, c)
+				<-g.workers
+
+				if err != nil {
+					log.WithError(err).Errorf("error applying change to %q", c.Path)
+					atomic.AddInt64(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	for _, c := range changes {
+		if ctx.Err() != nil {
+			break
+		}
+		changesChan <- c
+	}
+	close(changesChan)
+	wg.Wait()
+
+	return int(failed)
+}
+
+// applyChange updates the cache file of a changed source file.
+func (g *ReverseGeocoder) applyChange(country string, c fileChange) error {
+	// the previous version might not be cached anymore, e.g. if its place type
+	// is now disabled
+	err := os.Remove(g.cacheFile(country, c.Path))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing cache file: %w", err)
+	}
+	if c.Status == "D" {
+		return nil
+	}
+
+	_, err = g.processGeojson(country, c.Path)
+	if err != nil {
+		return fmt.Errorf("error processing geojson: %w", err)
+	}
+
+	return nil
+}
+
+// placeTypesKey returns a key identifying the enabled place types.
+func (g *ReverseGeocoder) placeTypesKey() string {
+	if len(g.enabledPlaceTypes) == 0 {
+		return "*"
+	}
+
+	placeTypes := append([]string(nil), g.enabledPlaceTypes...)
+	sort.Strings(placeTypes)
+
+	return strings.Join(placeTypes, ",")
+}
@@ -0,0 +1,256 @@
+package geocoding
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// runGit runs a git command in the repository of country xx.
+func runGit(t *testing.T, g *ReverseGeocoder, args ...string) string {
+	t.Helper()
+
+	return runGitIn(t, g.repoPath("xx"), args...)
+}
+
+// runGitIn runs a git command in a directory.
+func runGitIn(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// testGitRepoGeocoder returns a geocoder for country xx whose repository is a
+// git repository.
+func testGitRepoGeocoder(t *testing.T, enabledPlaceTypes ...string) *ReverseGeocoder {
+	t.Helper()
+
+	g := testRepoGeocoder(t)
+	g.enabledPlaceTypes = enabledPlaceTypes
+	runGit(t, g, "init", "-q")
+
+	return g
+}
+
+func commit(t *testing.T, g *ReverseGeocoder) string {
+	t.Helper()
+
+	runGit(t, g, "add", "-A")
+	runGit(t, g, "commit", "-q", "-m", "update")
+
+	return runGit(t, g, "rev-parse", "HEAD")
+}
+
+// index indexes country xx from its repository and serves it, it returns the
+// number of cache files read and of source files processed.
+func index(t *testing.T, g *ReverseGeocoder) (hits, misses int64) {
+	t.Helper()
+
+	hits = atomic.LoadInt64(&g.cacheHits)
+	misses = atomic.LoadInt64(&g.cacheMisses)
+	delete(g.shapes, "xx")
+	err := g.indexCountry(context.Background(), "xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.rebuildIndexes()
+
+	return atomic.LoadInt64(&g.cacheHits) - hits, atomic.LoadInt64(&g.cacheMisses) - misses
+}
+
+func indexedCommit(t *testing.T, g *ReverseGeocoder) string {
+	t.Helper()
+
+	manifest, err := g.readCacheManifest("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest == nil {
+		t.Fatal("no cache manifest")
+	}
+
+	return manifest.Commit
+}
+
+func TestChangedFiles(t *testing.T) {
+	g := testGitRepoGeocoder(t)
+	writeSource(t, g, "data/1/modified.geojson", 1, "Modified", "locality", 10, 10)
+	writeSource(t, g, "data/2/deleted.geojson", 2, "Deleted", "locality", 20, 20)
+	writeSource(t, g, "data/3/renamed.geojson", 3, "Renamed", "locality", 30, 30)
+	writeSource(t, g, "data/4/unchanged.geojson", 4, "Unchanged", "locality", 40, 40)
+	err := os.WriteFile(filepath.Join(g.repoPath("xx"), "README.md"), []byte("readme"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := commit(t, g)
+
+	writeSource(t, g, "data/1/modified.geojson", 1, "Modified again", "locality", 10, 10)
+	runGit(t, g, "rm", "-q", "data/2/deleted.geojson")
+	// -z keeps paths with special characters unquoted
+	runGit(t, g, "mv", "data/3/renamed.geojson", "data/3/renamed to é.geojson")
+	writeSource(t, g, "data/5/added.geojson", 5, "Added", "locality", 50, 50)
+	err = os.WriteFile(filepath.Join(g.repoPath("xx"), "README.md"), []byte("updated readme"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := commit(t, g)
+
+	changes, err := g.changedFiles(context.Background(), "xx", from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := func(rel string) string {
+		return filepath.Join(g.repoPath("xx"), filepath.FromSlash(rel))
+	}
+	want := []fileChange{
+		{Status: "M", Path: path("data/1/modified.geojson")},
+		{Status: "D", Path: path("data/2/deleted.geojson")},
+		// renames are an addition and a deletion
+		{Status: "A", Path: path("data/3/renamed to é.geojson")},
+		{Status: "D", Path: path("data/3/renamed.geojson")},
+		{Status: "A", Path: path("data/5/added.geojson")},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("got changes %v, want %v", changes, want)
+	}
+
+	changes, err = g.changedFiles(context.Background(), "xx", to, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("got changes %v between the same commits", changes)
+	}
+}
+
+func TestIndexChangedFiles(t *testing.T) {
+	g := testGitRepoGeocoder(t)
+	writeSource(t, g, "data/1/1.geojson", 1, "Modified", "locality", 10, 10)
+	deleted := writeSource(t, g, "data/2/2.geojson", 2, "Deleted", "locality", 20, 20)
+	writeSource(t, g, "data/3/3.geojson", 3, "Renamed", "locality", 30, 30)
+	writeSource(t, g, "data/4/4.geojson", 4, "Unchanged", "locality", 40, 40)
+	head := commit(t, g)
+	index(t, g)
+	if got := indexedCommit(t, g); got != head {
+		t.Fatalf("got indexed commit %q, want %q", got, head)
+	}
+
+	writeSource(t, g, "data/1/1.geojson", 1, "Modified again", "locality", 10, 10)
+	runGit(t, g, "rm", "-q", "data/2/2.geojson")
+	runGit(t, g, "mv", "data/3/3.geojson", "data/3/3-renamed.geojson")
+	head = commit(t, g)
+
+	// unchanged files aren't processed
+	if _, misses := index(t, g); misses != 2 {
+		t.Errorf("got %d files processed, want only the 2 changed files", misses)
+	}
+	if got := indexedCommit(t, g); got != head {
+		t.Errorf("got indexed commit %q, want %q", got, head)
+	}
+
+	tests := []struct {
+		lat, lng     float64
+		wantLocality string
+	}{
+		{lat: 10, lng: 10, wantLocality: "Modified again"},
+		{lat: 20, lng: 20, wantLocality: ""},
+		{lat: 30, lng: 30, wantLocality: "Renamed"},
+		{lat: 40, lng: 40, wantLocality: "Unchanged"},
+	}
+	for _, tt := range tests {
+		if loc := g.LocationFromLatLng(tt.lat, tt.lng); loc.Locality != tt.wantLocality {
+			t.Errorf("%v,%v: got locality %q, want %q", tt.lat, tt.lng, loc.Locality, tt.wantLocality)
+		}
+	}
+
+	// the cache files of deleted and renamed sources are removed
+	if exists(t, g.cacheFile("xx", deleted)) {
+		t.Error("cache file of a deleted source kept")
+	}
+	if exists(t, g.cacheFile("xx", filepath.Join(g.repoPath("xx"), "data/3/3.geojson"))) {
+		t.Error("cache file of a renamed source kept")
+	}
+	if polygons := len(g.shapes["xx"]); polygons != 3 {
+		t.Errorf("got %d polygons, want %d", polygons, 3)
+	}
+}
+
+func TestIndexUnknownCommit(t *testing.T) {
+	g := testGitRepoGeocoder(t)
+	writeSource(t, g, "data/1/1.geojson", 1, "Unchanged", "locality", 10, 10)
+	writeSource(t, g, "data/2/2.geojson", 2, "Modified", "locality", 20, 20)
+	commit(t, g)
+	index(t, g)
+
+	// e.g. the repository history was rewritten
+	err := g.setIndexedCommit("xx", strings.Repeat("0", 40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSource(t, g, "data/2/2.geojson", 2, "Modified again", "locality", 20, 20)
+	head := commit(t, g)
+
+	if hits, _ := index(t, g); hits != 1 {
+		t.Errorf("got %d cache hits, want all files processed", hits)
+	}
+	if got := indexedCommit(t, g); got != head {
+		t.Errorf("got indexed commit %q, want %q", got, head)
+	}
+	if loc := g.LocationFromLatLng(20, 20); loc.Locality != "Modified again" {
+		t.Errorf("got locality %q, want %q", loc.Locality, "Modified again")
+	}
+	if loc := g.LocationFromLatLng(10, 10); loc.Locality != "Unchanged" {
+		t.Errorf("got locality %q, want %q", loc.Locality, "Unchanged")
+	}
+}
+
+func TestIndexPlaceTypesChanged(t *testing.T) {
+	g := testGitRepoGeocoder(t, "locality")
+	writeSource(t, g, "data/1/1.geojson", 1, "Locality", "locality", 10, 10)
+	writeSource(t, g, "data/2/2.geojson", 2, "Region", "region", 10, 10)
+	head := commit(t, g)
+	index(t, g)
+	if loc := g.LocationFromLatLng(10, 10); loc.Region != "" {
+		t.Fatalf("got region %q while regions are disabled", loc.Region)
+	}
+
+	// the region file didn't change but was never cached
+	g.enabledPlaceTypes = []string{"region", "locality"}
+	if hits, _ := index(t, g); hits != 1 {
+		t.Errorf("got %d cache hits, want all files processed", hits)
+	}
+	if loc := g.LocationFromLatLng(10, 10); loc.Region != "Region" || loc.Locality != "Locality" {
+		t.Errorf("got %v, want the region and the locality", loc)
+	}
+
+	manifest, err := g.readCacheManifest("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Commit != head || manifest.PlaceTypes != "locality,region" {
+		t.Errorf("got manifest %+v, want commit %q and place types %q", manifest, head, "locality,region")
+	}
+
+	// the same place types in another order don't
+	g.enabledPlaceTypes = []string{"locality", "region"}
+	if _, misses := index(t, g); misses != 0 {
+		t.Errorf("got %d files processed, want none", misses)
+	}
+}
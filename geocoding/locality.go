@@ -0,0 +1,148 @@
+package geocoding
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+	log "github.com/sirupsen/logrus"
+)
+
+const earthRadiusKm = 6371.01
+
+// placePoint is a place that only has a point geometry, it is used as a
+// fallback when no locality polygon contains a location.
+type placePoint struct {
+	s2.PointVector
+	// place is the index of the place in the place table
+	place uint32
+}
+
+func newPlacePoint(p s2.Point, place uint32) *placePoint {
+	return &placePoint{
+		PointVector: s2.PointVector{p},
+		place:       place,
+	}
+}
+
+// nearestLocality returns the closest locality point from the given point,
+// within the configured maximum distance.
+func (g *ReverseGeocoder) nearestLocality(pt s2.Point) (*placePoint, float64) {
+	if g.localities == nil {
+		return nil, 0
+	}
+
+	opts := s2.NewClosestEdgeQueryOptions().
+		MaxResults(1).
+		DistanceLimit(s1.ChordAngleFromAngle(s1.Angle(g.localityMaxDistanceKm / earthRadiusKm)))
+	q := s2.NewClosestEdgeQuery(g.localities, opts)
+	res := q.FindEdges(s2.NewMinDistanceToPointTarget(pt))
+	if len(res) == 0 {
+		return nil, 0
+	}
+
+	p := g.localities.Shape(res[0].ShapeID()).(*placePoint)
+	return p, res[0].Distance().Angle().Radians() * earthRadiusKm
+}
+
+// loadGeoNames loads a GeoNames cities file (e.g. cities1000.txt) into the
+// locality points index. Only populated places from the given countries are
+// loaded, or all of them if countries is empty.
+func (g *ReverseGeocoder) loadGeoNames(path string, countries []string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening file: %w", err)
+	}
+	defer f.Close()
+
+	filter := make(map[string]struct{}, len(countries))
+	for _, c := range countries {
+		filter[c] = struct{}{}
+	}
+
+	var count int
+	scanner := bufio.NewScanner(f)
+	// alternate names can make lines very long
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 9 {
+			continue
+		}
+
+		name := fields[1]
+		featureClass := fields[6]
+		countryCode := strings.ToLower(fields[8])
+		if name == "" || featureClass != "P" {
+			continue
+		}
+		if _, ok := filter[countryCode]; len(filter) > 0 && !ok {
+			continue
+		}
+
+		lat, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return fmt.Errorf("invalid latitude for %q: %w", name, err)
+		}
+		lng, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			return fmt.Errorf("invalid longitude for %q: %w", name, err)
+		}
+
+		// fields share the memory of the whole line, the name is copied so that
+		// the line can be freed
+		pt := s2.PointFromLatLng(s2.LatLngFromDegrees(lat, lng))
+		g.addCachedFile(countryCode, &cachedFile{
+			Valid: true,
+			Place: Place{
+				Name:      string([]byte(name)),
+				PlaceType: "locality",
+				Country:   fields[8],
+				Centroid:  Coordinates{Latitude: lat, Longitude: lng},
+				BBox:      [4]float64{lng, lat, lng, lat},
+			},
+			Point: &pt,
+		})
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	log.WithField("path", path).Infof("loaded %d GeoNames localities", count)
+
+	return nil
+}
+
+// withoutGeoNames returns the shapes that don't come from the GeoNames file,
+// which is loaded again after each load. It must be called with shapesMu held.
+func (g *ReverseGeocoder) withoutGeoNames(shapes []s2.Shape) []s2.Shape {
+	res := make([]s2.Shape, 0, len(shapes))
+	for _, s := range shapes {
+		if p, ok := s.(*placePoint); ok && g.placeTable.get(p.place).ID == 0 {
+			continue
+		}
+		res = append(res, s)
+	}
+
+	return res
+}
+
+// loadLocalityFallback loads the optional datasets used by the nearest
+// locality fallback for the given countries.
+func (g *ReverseGeocoder) loadLocalityFallback(countries []string) error {
+	if g.localities == nil || g.geoNamesPath == "" || !g.placeTypeEnabled("locality") {
+		return nil
+	}
+
+	err := g.loadGeoNames(g.geoNamesPath, countries)
+	if err != nil {
+		return fmt.Errorf("error loading GeoNames file %q: %w", g.geoNamesPath, err)
+	}
+
+	return nil
+}
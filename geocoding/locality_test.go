@@ -0,0 +1,201 @@
+package geocoding
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const testGeoNamesPath = "testdata/cities.txt"
+
+// geoNamesNames returns the names of the GeoNames places loaded per country.
+func geoNamesNames(g *ReverseGeocoder) map[string][]string {
+	res := make(map[string][]string)
+	for country, shapes := range g.shapes {
+		for _, s := range shapes {
+			if p, ok := s.(*placePoint); ok {
+				res[country] = append(res[country], g.placeTable.get(p.place).Name)
+			}
+		}
+		sort.Strings(res[country])
+	}
+
+	return res
+}
+
+func TestLoadGeoNames(t *testing.T) {
+	g := NewReverseGeocoder("", "", nil, nil, WithLocalityFallback(testGeoNamesPath, 10))
+	err := g.loadGeoNames(testGeoNamesPath, []string{"fr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paris *Place
+	for _, s := range g.shapes["fr"] {
+		if p := g.placeTable.get(s.(*placePoint).place); p.Name == "Paris" {
+			paris = p
+		}
+	}
+	if paris == nil {
+		t.Fatal("Paris not loaded")
+	}
+	want := Place{
+		Name:      "Paris",
+		PlaceType: "locality",
+		Country:   "FR",
+		Centroid:  Coordinates{Latitude: 48.85341, Longitude: 2.3488},
+		BBox:      [4]float64{2.3488, 48.85341, 2.3488, 48.85341},
+	}
+	if !reflect.DeepEqual(*paris, want) {
+		t.Errorf("got %+v, want %+v", *paris, want)
+	}
+}
+
+func TestLoadGeoNamesCountries(t *testing.T) {
+	tests := []struct {
+		countries []string
+		want      map[string][]string
+	}{
+		{
+			// only populated places with a name are loaded
+			countries: nil,
+			want: map[string][]string{
+				"de": {"Berlin"},
+				"fr": {"Lyon", "Paris"},
+				"xx": {"Between", "Inside"},
+			},
+		},
+		{
+			countries: []string{"fr"},
+			want: map[string][]string{
+				"fr": {"Lyon", "Paris"},
+			},
+		},
+		{
+			countries: []string{"de", "it"},
+			want: map[string][]string{
+				"de": {"Berlin"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		g := NewReverseGeocoder("", "", nil, nil, WithLocalityFallback(testGeoNamesPath, 10))
+		err := g.loadGeoNames(testGeoNamesPath, tt.countries)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := geoNamesNames(g); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.countries, got, tt.want)
+		}
+	}
+}
+
+func TestLoadGeoNamesInvalidCoordinates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cities.txt")
+	err := os.WriteFile(path, []byte("1\tNowhere\tNowhere\t\tnorth\t2.0\tP\tPPL\tFR\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := NewReverseGeocoder("", "", nil, nil, WithLocalityFallback(path, 10))
+	err = g.loadGeoNames(path, nil)
+	if err == nil {
+		t.Error("invalid latitude accepted")
+	}
+}
+
+func TestLocalityFallback(t *testing.T) {
+	g := testGeocoder(WithLocalityFallback(testGeoNamesPath, 10))
+	err := g.loadGeoNames(testGeoNamesPath, []string{"xx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.rebuildIndexes()
+
+	tests := []struct {
+		lat, lng     float64
+		wantLocality string
+		fallback     bool
+	}{
+		// inside a locality polygon, the GeoNames point at its center isn't
+		// used
+		{lat: 47, lng: 5, wantLocality: "locality 37"},
+		{lat: 47.05, lng: 5.05, wantLocality: "locality 37"},
+		// no locality polygon, the nearest point is within 10km
+		{lat: 46.02, lng: 4.02, wantLocality: "Between", fallback: true},
+		{lat: 46.05, lng: 4.05, wantLocality: "Between", fallback: true},
+		// no locality polygon and the nearest point is too far
+		{lat: 46.2, lng: 4, wantLocality: ""},
+		{lat: 45, lng: 4, wantLocality: ""},
+	}
+
+	for _, tt := range tests {
+		loc := g.LocationFromLatLng(tt.lat, tt.lng)
+		if loc.Locality != tt.wantLocality {
+			t.Errorf("%v,%v: got locality %q, want %q", tt.lat, tt.lng, loc.Locality, tt.wantLocality)
+		}
+		if loc.Country != "country 1" {
+			t.Errorf("%v,%v: got country %q, want %q", tt.lat, tt.lng, loc.Country, "country 1")
+		}
+		if fallback := loc.LocalityDistance != nil; fallback != tt.fallback {
+			t.Errorf("%v,%v: got distance %v, want fallback %v", tt.lat, tt.lng, loc.LocalityDistance, tt.fallback)
+		}
+		if tt.fallback && loc.LocalityDistance != nil && *loc.LocalityDistance > 10 {
+			t.Errorf("%v,%v: got distance %vkm beyond the maximum distance", tt.lat, tt.lng, *loc.LocalityDistance)
+		}
+	}
+
+	// on the locality point, the distance is set to 0
+	loc := g.LocationFromLatLng(46, 4)
+	if loc.LocalityDistance == nil || *loc.LocalityDistance != 0 {
+		t.Errorf("got distance %v on the locality point, want 0", loc.LocalityDistance)
+	}
+	b, err := json.Marshal(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"LocalityDistance":0`) {
+		t.Errorf("got %s, want a LocalityDistance of 0", b)
+	}
+}
+
+func TestLocalityFallbackFailedReload(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCache(t, dir)
+	g := NewReverseGeocoder("", dir, []string{"xx"}, nil, WithLocalityFallback(testGeoNamesPath, 10))
+	err := g.LoadCachedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"xx": {"Between", "Inside"}}
+	if got := geoNamesNames(g); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// the previous shapes are kept when the country fails to load
+	err = os.Remove(g.cacheManifestFile("xx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		err = g.LoadCachedFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state := g.Status()[0].State; state != LoadStateStale {
+			t.Errorf("got state %v, want %v", state, LoadStateStale)
+		}
+		if got := geoNamesNames(g); !reflect.DeepEqual(got, want) {
+			t.Errorf("reload %d: got %v, want %v", i, got, want)
+		}
+		if got := g.localities.Len(); got != 2 {
+			t.Errorf("reload %d: got %d indexed locality points, want 2", i, got)
+		}
+	}
+}
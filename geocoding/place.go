@@ -0,0 +1,255 @@
+package geocoding
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/golang/geo/s2"
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// Place is a place from WOF, or a GeoNames locality.
+type Place struct {
+	// ID is the WOF id of the place, zero for GeoNames localities.
+	ID        int64 `json:",omitempty"`
+	Name      string
+	PlaceType string
+	// Country is the ISO country code of the place, e.g. "FR".
+	Country string `json:",omitempty"`
+	// Centroid is the centroid of the place and BBox its bounding box as
+	// [min longitude, min latitude, max longitude, max latitude].
+	Centroid Coordinates
+	BBox     [4]float64
+	// ParentID is the WOF id of the parent place, zero if unknown.
+	ParentID int64 `json:",omitempty"`
+
+	// polygons are the simplified polygons of the place, if any
+	polygons []*s2.Polygon
+}
+
+// Coordinates are coordinates in degrees.
+type Coordinates struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Geometry returns the simplified geometry of the place as a MultiPolygon,
+// or its centroid for places without polygons.
+func (p *Place) Geometry() *geojson.Geometry {
+	if len(p.polygons) == 0 {
+		return geojson.NewPointGeometry([]float64{p.Centroid.Longitude, p.Centroid.Latitude})
+	}
+
+	var multiPolygon [][][][]float64
+	for _, polygon := range p.polygons {
+		for _, loop := range polygon.Loops() {
+			ring := loopCoordinates(loop)
+			if loop.IsHole() && len(multiPolygon) > 0 {
+				last := len(multiPolygon) - 1
+				multiPolygon[last] = append(multiPolygon[last], ring)
+				continue
+			}
+			multiPolygon = append(multiPolygon, [][][]float64{ring})
+		}
+	}
+
+	return geojson.NewMultiPolygonGeometry(multiPolygon...)
+}
+
+// loopCoordinates returns the closed ring of [longitude, latitude] of a loop.
+func loopCoordinates(loop *s2.Loop) [][]float64 {
+	ring := make([][]float64, 0, loop.NumVertices()+1)
+	for _, v := range loop.Vertices() {
+		ll := s2.LatLngFromPoint(v)
+		ring = append(ring, []float64{ll.Lng.Degrees(), ll.Lat.Degrees()})
+	}
+	if len(ring) > 0 {
+		ring = append(ring, ring[0])
+	}
+
+	return ring
+}
+
+// placeTableChunk is the number of places per chunk of a place table, and
+// placeTableChunks the maximum number of chunks.
+const (
+	placeTableChunk  = 1 << 12
+	placeTableChunks = 1 << 16
+)
+
+// placeTable stores each loaded place once, the shapes reference their place
+// by index. Places are stored in chunks that are never moved, so that places
+// can be added while the places of the served indexes are read. The strings
+// shared by many places, such as the place type and the country, are
+// interned.
+type placeTable struct {
+	chunks  [placeTableChunks]*[placeTableChunk]Place
+	n       uint32
+	strings map[string]string
+}
+
+func newPlaceTable() *placeTable {
+	return &placeTable{
+		strings: make(map[string]string),
+	}
+}
+
+// add adds a place and returns its index, it must be called with shapesMu
+// held.
+func (t *placeTable) add(p Place) uint32 {
+	i := t.n
+	chunk := i / placeTableChunk
+	if chunk >= placeTableChunks {
+		panic("geocoding: too many places")
+	}
+	if t.chunks[chunk] == nil {
+		t.chunks[chunk] = new([placeTableChunk]Place)
+	}
+
+	p.PlaceType = t.intern(p.PlaceType)
+	p.Country = t.intern(p.Country)
+	t.chunks[chunk][i%placeTableChunk] = p
+	t.n++
+
+	return i
+}
+
+// get returns the place at index i.
+func (t *placeTable) get(i uint32) *Place {
+	return &t.chunks[i/placeTableChunk][i%placeTableChunk]
+}
+
+func (t *placeTable) len() int {
+	return int(t.n)
+}
+
+func (t *placeTable) intern(s string) string {
+	if interned, ok := t.strings[s]; ok {
+		return interned
+	}
+	// copied so that an interned substring doesn't keep a larger string alive
+	s = string([]byte(s))
+	t.strings[s] = s
+
+	return s
+}
+
+// PlaceByID returns the loaded place with the given WOF id, or nil.
+func (g *ReverseGeocoder) PlaceByID(id int64) *Place {
+	g.indexMu.RLock()
+	defer g.indexMu.RUnlock()
+
+	return g.places[id]
+}
+
+// placeFromFeature returns the place of a WOF feature. The centroid and the
+// bounding box are computed from the geometry when the feature doesn't have
+// them.
+func placeFromFeature(feature *geojson.Feature, name, placeType string) Place {
+	p := Place{
+		ID:        int64(numberProperty(feature, "wof:id")),
+		Name:      name,
+		PlaceType: placeType,
+		ParentID:  int64(numberProperty(feature, "wof:parent_id")),
+	}
+	if p.ParentID < 0 {
+		// -1 means unknown in WOF
+		p.ParentID = 0
+	}
+	if country, ok := feature.Properties["wof:country"].(string); ok {
+		p.Country = country
+	}
+
+	bbox, ok := parseBBox(feature.Properties["geom:bbox"])
+	if !ok {
+		bbox = geometryBBox(feature.Geometry)
+	}
+	p.BBox = bbox
+
+	lat, latOK := feature.Properties["geom:latitude"].(float64)
+	lng, lngOK := feature.Properties["geom:longitude"].(float64)
+	if latOK && lngOK {
+		p.Centroid = Coordinates{Latitude: lat, Longitude: lng}
+	} else {
+		p.Centroid = Coordinates{
+			Latitude:  (bbox[1] + bbox[3]) / 2,
+			Longitude: (bbox[0] + bbox[2]) / 2,
+		}
+	}
+
+	return p
+}
+
+// numberProperty returns a numeric property, which WOF sometimes encodes as a
+// string.
+func numberProperty(feature *geojson.Feature, key string) float64 {
+	switch v := feature.Properties[key].(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+
+	return 0
+}
+
+// parseBBox parses a WOF "minx,miny,maxx,maxy" bounding box.
+func parseBBox(v interface{}) ([4]float64, bool) {
+	var res [4]float64
+	s, ok := v.(string)
+	if !ok {
+		return res, false
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return res, false
+	}
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return res, false
+		}
+		res[i] = f
+	}
+
+	return res, true
+}
+
+func geometryBBox(geometry *geojson.Geometry) [4]float64 {
+	bbox := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	extend := func(pt []float64) {
+		bbox[0] = math.Min(bbox[0], pt[0])
+		bbox[1] = math.Min(bbox[1], pt[1])
+		bbox[2] = math.Max(bbox[2], pt[0])
+		bbox[3] = math.Max(bbox[3], pt[1])
+	}
+
+	switch {
+	case geometry == nil:
+	case geometry.IsPoint():
+		extend(geometry.Point)
+	case geometry.IsPolygon():
+		for _, ring := range geometry.Polygon {
+			for _, pt := range ring {
+				extend(pt)
+			}
+		}
+	case geometry.IsMultiPolygon():
+		for _, polygon := range geometry.MultiPolygon {
+			for _, ring := range polygon {
+				for _, pt := range ring {
+					extend(pt)
+				}
+			}
+		}
+	}
+
+	if math.IsInf(bbox[0], 1) {
+		return [4]float64{}
+	}
+
+	return bbox
+}
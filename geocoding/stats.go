@@ -0,0 +1,96 @@
+package geocoding
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats contains statistics about the index and its usage.
+type Stats struct {
+	// Polygons is the number of indexed polygons per country and place type.
+	Polygons map[string]map[string]int
+	// LoadDurations is the time it took to load each country.
+	LoadDurations map[string]time.Duration
+	// LastUpdate is when the data was last loaded, zero while loading.
+	LastUpdate time.Time
+
+	// CacheHits counts the cache files read instead of processing their
+	// source, CacheMisses the source files that had to be processed, by all
+	// the load paths.
+	CacheHits   int64
+	CacheMisses int64
+
+	// Lookups is the number of locations looked up, EmptyLookups the number
+	// of those without any result.
+	Lookups      int64
+	EmptyLookups int64
+
+	// CellCacheEnabled is set when the cell cache is enabled. CellCacheHits
+	// and CellCacheMisses count the lookups answered from the cell cache or
+	// from the index, CellCacheEntries is the number of cached cells.
+	CellCacheEnabled bool
+	CellCacheHits    int64
+	CellCacheMisses  int64
+	CellCacheEntries int
+
+	// CoveringHits and CoveringFallbacks count the lookups answered from the
+	// covering table or, near a boundary, from the index. They are zero when
+	// the covering table is disabled.
+	CoveringHits      int64
+	CoveringFallbacks int64
+}
+
+// Stats returns statistics about the index and its usage.
+func (g *ReverseGeocoder) Stats() Stats {
+	g.statsMu.Lock()
+	defer g.statsMu.Unlock()
+
+	res := Stats{
+		Polygons:      make(map[string]map[string]int, len(g.polygonCounts)),
+		LoadDurations: make(map[string]time.Duration, len(g.loadDurations)),
+		LastUpdate:    g.lastUpdate,
+		CacheHits:     atomic.LoadInt64(&g.cacheHits),
+		CacheMisses:   atomic.LoadInt64(&g.cacheMisses),
+		Lookups:       atomic.LoadInt64(&g.lookups),
+		EmptyLookups:  atomic.LoadInt64(&g.emptyLookups),
+
+		CoveringHits:      atomic.LoadInt64(&g.coveringHits),
+		CoveringFallbacks: atomic.LoadInt64(&g.coveringFallbacks),
+	}
+	if g.cellCache != nil {
+		res.CellCacheEnabled = true
+		res.CellCacheHits = atomic.LoadInt64(&g.cellCache.hits)
+		res.CellCacheMisses = atomic.LoadInt64(&g.cellCache.misses)
+		res.CellCacheEntries = g.cellCache.len()
+	}
+	for country, counts := range g.polygonCounts {
+		res.Polygons[country] = make(map[string]int, len(counts))
+		for placeType, n := range counts {
+			res.Polygons[country][placeType] = n
+		}
+	}
+	for country, d := range g.loadDurations {
+		res.LoadDurations[country] = d
+	}
+
+	return res
+}
+
+func (g *ReverseGeocoder) countPolygon(country, placeType string) {
+	g.statsMu.Lock()
+	defer g.statsMu.Unlock()
+
+	counts, ok := g.polygonCounts[country]
+	if !ok {
+		counts = make(map[string]int)
+		g.polygonCounts[country] = counts
+	}
+	counts[placeType]++
+}
+
+func (g *ReverseGeocoder) setLoadDuration(country string, d time.Duration) {
+	g.statsMu.Lock()
+	defer g.statsMu.Unlock()
+
+	g.loadDurations[country] = d
+}
@@ -0,0 +1,159 @@
+package geocoding
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrCountriesFailed is returned when some countries couldn't be loaded.
+var ErrCountriesFailed = errors.New("some countries failed to load")
+
+// LoadState is the load state of a country.
+type LoadState string
+
+const (
+	// LoadStatePending means the country hasn't been loaded yet.
+	LoadStatePending LoadState = "pending"
+	// LoadStateLoaded means the country is loaded and up-to-date.
+	LoadStateLoaded LoadState = "loaded"
+	// LoadStateStale means the repository couldn't be updated and the
+	// existing cache was loaded instead.
+	LoadStateStale LoadState = "stale"
+	// LoadStateFailed means the country couldn't be loaded.
+	LoadStateFailed LoadState = "failed"
+)
+
+// CountryStatus is the load status of a country.
+type CountryStatus struct {
+	Country   string
+	State     LoadState
+	Error     string `json:",omitempty"`
+	UpdatedAt time.Time
+}
+
+// Status returns the load status of all the countries.
+func (g *ReverseGeocoder) Status() []CountryStatus {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	res := make([]CountryStatus, 0, len(g.countries))
+	for _, c := range g.countries {
+		s, ok := g.status[c]
+		if !ok {
+			s = CountryStatus{
+				Country: c,
+				State:   LoadStatePending,
+			}
+		}
+		res = append(res, s)
+	}
+
+	return res
+}
+
+// Loaded returns whether a country is loaded, possibly from a stale cache.
+func (g *ReverseGeocoder) Loaded(country string) bool {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	s := g.status[country]
+	return s.State == LoadStateLoaded || s.State == LoadStateStale
+}
+
+func (g *ReverseGeocoder) setStatus(country string, state LoadState, err error) {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	s := CountryStatus{
+		Country:   country,
+		State:     state,
+		UpdatedAt: time.Now(),
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	g.status[country] = s
+	if g.loadDone != nil {
+		g.loadDone[country] = struct{}{}
+	}
+}
+
+// failedCountriesError returns an error wrapping ErrCountriesFailed if some
+// countries failed to load.
+func (g *ReverseGeocoder) failedCountriesError() error {
+	var failed []string
+	for _, s := range g.Status() {
+		if s.State == LoadStateFailed {
+			failed = append(failed, s.Country)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrCountriesFailed, strings.Join(failed, ", "))
+}
+
+// Progress is the loading progress of a geocoder.
+type Progress struct {
+	// Ready is true once the data has been loaded, even if some countries
+	// failed.
+	Ready          bool
+	CountriesDone  int
+	CountriesTotal int
+	PolygonsLoaded int64
+	StartedAt      time.Time
+	// EstimatedRemaining is the estimated remaining loading time, based on
+	// the number of countries done. It is zero when unknown.
+	EstimatedRemaining time.Duration
+}
+
+// Progress returns the progress of the current or last load, which covers
+// all the countries or a single one when it is loaded with LoadCountry.
+func (g *ReverseGeocoder) Progress() Progress {
+	res := Progress{
+		Ready:          atomic.LoadInt32(&g.ready) == 1,
+		PolygonsLoaded: atomic.LoadInt64(&g.polygonsLoaded),
+	}
+
+	g.statusMu.Lock()
+	res.StartedAt = g.loadStartedAt
+	res.CountriesDone = len(g.loadDone)
+	res.CountriesTotal = g.loadCountries
+	if g.loadDone == nil {
+		// not started yet
+		res.CountriesTotal = len(g.countries)
+	}
+	g.statusMu.Unlock()
+
+	if !res.StartedAt.IsZero() && res.CountriesDone > 0 && res.CountriesDone < res.CountriesTotal {
+		elapsed := time.Since(res.StartedAt)
+		remaining := res.CountriesTotal - res.CountriesDone
+		res.EstimatedRemaining = elapsed / time.Duration(res.CountriesDone) * time.Duration(remaining)
+	}
+
+	return res
+}
+
+// startLoading resets the loading progress for a load of the given
+// countries. The countries keep their status, and their previous data is
+// served, until they are done.
+func (g *ReverseGeocoder) startLoading(countries []string) {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	g.loadStartedAt = time.Now()
+	g.loadCountries = len(countries)
+	g.loadDone = make(map[string]struct{}, len(countries))
+}
+
+func (g *ReverseGeocoder) setReady() {
+	atomic.StoreInt32(&g.ready, 1)
+
+	g.statsMu.Lock()
+	g.lastUpdate = time.Now()
+	g.statsMu.Unlock()
+}
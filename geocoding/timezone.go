@@ -0,0 +1,204 @@
+package geocoding
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"os"
+	"time"
+
+	"github.com/golang/geo/s2"
+	geojson "github.com/paulmach/go.geojson"
+	log "github.com/sirupsen/logrus"
+)
+
+// timezonePolygon is a polygon of a timezone boundary.
+type timezonePolygon struct {
+	*s2.Polygon
+	TZID     string
+	Location *time.Location
+}
+
+// cachedTimezones is the cached version of a timezone boundaries file.
+type cachedTimezones struct {
+	Manifest  cacheManifest
+	Hash      string
+	Timezones []cachedFile
+}
+
+// timezone returns the timezone at the given point, or nil.
+func (g *ReverseGeocoder) timezone(pt s2.Point) *timezonePolygon {
+	if g.timezones == nil {
+		return nil
+	}
+
+	q := s2.NewContainsPointQuery(g.timezones, s2.VertexModelOpen)
+	shapes := q.ContainingShapes(pt)
+	if len(shapes) == 0 {
+		return nil
+	}
+
+	return shapes[0].(*timezonePolygon)
+}
+
+// offset returns the timezone id and its current UTC offset, empty for a nil
+// timezone.
+func (tz *timezonePolygon) offset() (string, string) {
+	if tz == nil {
+		return "", ""
+	}
+	if tz.Location == nil {
+		return tz.TZID, ""
+	}
+
+	return tz.TZID, time.Now().In(tz.Location).Format("-07:00")
+}
+
+// loadTimezones loads the timezone boundaries into the timezones index, using
+// the cache when the source file hasn't changed.
+func (g *ReverseGeocoder) loadTimezones() error {
+	if g.timezones == nil {
+		return nil
+	}
+
+	cache, err := g.loadCachedTimezones()
+	if err != nil {
+		log.WithError(err).Warn("error loading cached timezones")
+	}
+	if cache == nil {
+		log.WithField("path", g.timezonesPath).Info("processing timezones, this might take a while...")
+		cache, err = g.processTimezones()
+		if err != nil {
+			return fmt.Errorf("error processing timezones %q: %w", g.timezonesPath, err)
+		}
+	}
+
+	// build a new index and swap it, see rebuildIndexes
+	index := s2.NewShapeIndex()
+	for _, tz := range cache.Timezones {
+		loc, err := time.LoadLocation(tz.Place.Name)
+		if err != nil {
+			log.WithError(err).WithField("timezone", tz.Place.Name).Warn("unknown timezone, UTC offset won't be available")
+			loc = nil
+		}
+		for _, p := range tz.Polygons {
+			index.Add(&timezonePolygon{
+				Polygon:  p,
+				TZID:     tz.Place.Name,
+				Location: loc,
+			})
+		}
+	}
+	index.Build()
+
+	g.indexMu.Lock()
+	g.timezones = index
+	if g.cellCache != nil {
+		g.cellCache.reset()
+	}
+	g.indexMu.Unlock()
+	log.Infof("loaded %d timezones", len(cache.Timezones))
+
+	return nil
+}
+
+func (g *ReverseGeocoder) loadCachedTimezones() (*cachedTimezones, error) {
+	b, err := os.ReadFile(g.timezonesCacheFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var cache cachedTimezones
+	err = json.Unmarshal(b, &cache)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := fileHash(g.timezonesPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not get file hash: %w", err)
+	}
+	if hash != cache.Hash || !cache.Manifest.compatible() {
+		// file has changed or was cached by an incompatible version
+		return nil, nil
+	}
+
+	return &cache, nil
+}
+
+// processTimezones reads a timezone-boundary-builder geojson release and
+// writes its simplified cached version.
+func (g *ReverseGeocoder) processTimezones() (*cachedTimezones, error) {
+	b, err := os.ReadFile(g.timezonesPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+
+	fc, err := geojson.UnmarshalFeatureCollection(b)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling geojson: %w", err)
+	}
+
+	cache := cachedTimezones{
+		Manifest: currentCacheManifest(),
+		Hash:     fmt.Sprintf("%x", crc64.Checksum(b, crcTable)),
+	}
+	for _, feature := range fc.Features {
+		tzid, ok := feature.Properties["tzid"].(string)
+		if !ok || tzid == "" || feature.Geometry == nil {
+			continue
+		}
+
+		var srcPolygons [][][][]float64
+		switch {
+		case feature.Geometry.IsMultiPolygon():
+			srcPolygons = feature.Geometry.MultiPolygon
+		case feature.Geometry.IsPolygon():
+			srcPolygons = [][][][]float64{feature.Geometry.Polygon}
+		default:
+			continue
+		}
+
+		var polygons []*s2.Polygon
+		for _, p := range srcPolygons {
+			s2p, err := convertToS2Polygon(p)
+			if err != nil {
+				log.WithError(err).WithField("timezone", tzid).Error("ignoring polygon")
+				continue
+			}
+			if s2p != nil {
+				polygons = append(polygons, s2p)
+			}
+		}
+
+		cache.Timezones = append(cache.Timezones, cachedFile{
+			Valid: true,
+			Place: Place{
+				Name:      tzid,
+				PlaceType: "timezone",
+			},
+			Polygons: polygons,
+		})
+	}
+
+	err = os.MkdirAll(g.cacheFolder, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cache folder: %w", err)
+	}
+	err = writeFileAtomic(g.timezonesCacheFile(), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(&cache)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error writing cache: %w", err)
+	}
+
+	return &cache, nil
+}
+
+func (g *ReverseGeocoder) timezonesCacheFile() string {
+	return fmt.Sprintf("%s/timezones.json", g.cacheFolder)
+}
@@ -0,0 +1,156 @@
+package geocoding
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testTimezonesGeocoder returns a geocoder loading a copy of the timezones of
+// testdata, and the path of the copy.
+func testTimezonesGeocoder(t *testing.T) (*ReverseGeocoder, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	b, err := os.ReadFile("testdata/timezones.geojson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "timezones.geojson")
+	err = os.WriteFile(path, b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewReverseGeocoder("", filepath.Join(dir, "cache"), nil, nil, WithTimezones(path)), path
+}
+
+// reloadTimezones loads the timezones with a new geocoder sharing the source
+// and the cache of g.
+func reloadTimezones(t *testing.T, g *ReverseGeocoder) *ReverseGeocoder {
+	t.Helper()
+
+	g = NewReverseGeocoder("", g.cacheFolder, nil, nil, WithTimezones(g.timezonesPath))
+	err := g.loadTimezones()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return g
+}
+
+// editTimezonesCache rewrites the cached timezones of g.
+func editTimezonesCache(t *testing.T, g *ReverseGeocoder, edit func(c *cachedTimezones)) {
+	t.Helper()
+
+	b, err := os.ReadFile(g.timezonesCacheFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cache cachedTimezones
+	err = json.Unmarshal(b, &cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(&cache)
+	b, err = json.Marshal(&cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(g.timezonesCacheFile(), b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTimezones(t *testing.T) {
+	g, _ := testTimezonesGeocoder(t)
+	err := g.loadTimezones()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		lat, lng                    float64
+		wantTimezone, wantUTCOffset string
+	}{
+		{lat: 35.68, lng: 139.69, wantTimezone: "Asia/Tokyo", wantUTCOffset: "+09:00"},
+		{lat: 28.61, lng: 77.21, wantTimezone: "Asia/Kolkata", wantUTCOffset: "+05:30"},
+		// second polygon of a multipolygon
+		{lat: 11.62, lng: 92.73, wantTimezone: "Asia/Kolkata", wantUTCOffset: "+05:30"},
+		{lat: 0, lng: 0},
+	}
+	for _, tt := range tests {
+		loc := g.LocationFromLatLng(tt.lat, tt.lng)
+		if loc.Timezone != tt.wantTimezone || loc.UTCOffset != tt.wantUTCOffset {
+			t.Errorf("%v,%v: got timezone %q with offset %q, want %q with offset %q", tt.lat, tt.lng, loc.Timezone, loc.UTCOffset, tt.wantTimezone, tt.wantUTCOffset)
+		}
+	}
+}
+
+func TestTimezonesCache(t *testing.T) {
+	tests := []struct {
+		name string
+		// change modifies the source or the cache after a first load
+		change    func(t *testing.T, g *ReverseGeocoder, path string)
+		wantCache bool
+	}{
+		{
+			name:      "unchanged",
+			change:    func(t *testing.T, g *ReverseGeocoder, path string) {},
+			wantCache: true,
+		},
+		{
+			name: "changed source",
+			change: func(t *testing.T, g *ReverseGeocoder, path string) {
+				b, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.WriteFile(path, append(b, '\n'), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "outdated manifest",
+			change: func(t *testing.T, g *ReverseGeocoder, path string) {
+				editTimezonesCache(t, g, func(c *cachedTimezones) { c.Manifest.SchemaVersion-- })
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, path := testTimezonesGeocoder(t)
+			err := g.loadTimezones()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the cache is marked to tell whether it is used
+			editTimezonesCache(t, g, func(c *cachedTimezones) {
+				for i := range c.Timezones {
+					if c.Timezones[i].Place.Name == "Asia/Tokyo" {
+						c.Timezones[i].Place.Name = "Asia/Seoul"
+					}
+				}
+			})
+			tt.change(t, g, path)
+
+			g = reloadTimezones(t, g)
+			tz := g.LocationFromLatLng(35.68, 139.69).Timezone
+			if cached := tz == "Asia/Seoul"; cached != tt.wantCache {
+				t.Errorf("got timezone %q, want cache used %v", tz, tt.wantCache)
+			}
+
+			// the cache is up to date again
+			cache, err := g.loadCachedTimezones()
+			if err != nil || cache == nil {
+				t.Errorf("got cache %v, %v after loading", cache, err)
+			}
+		})
+	}
+}
@@ -10,6 +10,10 @@ require (
 	github.com/graph-gophers/graphql-go v1.1.0
 	github.com/hcliff/geo-simplification v0.0.0-00010101000000-000000000000
 	github.com/paulmach/go.geojson v1.4.0
+	github.com/prometheus/client_golang v1.11.1
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/viper v1.7.1
+	golang.org/x/time v0.0.0-20220224211638-0e9765cccd65
+	google.golang.org/grpc v1.46.2
+	google.golang.org/protobuf v1.28.1
 )
@@ -0,0 +1,4 @@
+// Package saltapb contains the gRPC API of Salta.
+package saltapb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative salta.proto
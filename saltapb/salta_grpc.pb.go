@@ -0,0 +1,180 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: salta.proto
+
+package saltapb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// GeocoderClient is the client API for Geocoder service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GeocoderClient interface {
+	// ReverseGeocode returns the location of a point.
+	ReverseGeocode(ctx context.Context, in *ReverseGeocodeRequest, opts ...grpc.CallOption) (*Location, error)
+	// ReverseGeocodeStream returns the location of each point sent, in the same
+	// order.
+	ReverseGeocodeStream(ctx context.Context, opts ...grpc.CallOption) (Geocoder_ReverseGeocodeStreamClient, error)
+}
+
+type geocoderClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGeocoderClient(cc grpc.ClientConnInterface) GeocoderClient {
+	return &geocoderClient{cc}
+}
+
+func (c *geocoderClient) ReverseGeocode(ctx context.Context, in *ReverseGeocodeRequest, opts ...grpc.CallOption) (*Location, error) {
+	out := new(Location)
+	err := c.cc.Invoke(ctx, "/salta.v1.Geocoder/ReverseGeocode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *geocoderClient) ReverseGeocodeStream(ctx context.Context, opts ...grpc.CallOption) (Geocoder_ReverseGeocodeStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Geocoder_ServiceDesc.Streams[0], "/salta.v1.Geocoder/ReverseGeocodeStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &geocoderReverseGeocodeStreamClient{stream}
+	return x, nil
+}
+
+type Geocoder_ReverseGeocodeStreamClient interface {
+	Send(*ReverseGeocodeRequest) error
+	Recv() (*Location, error)
+	grpc.ClientStream
+}
+
+type geocoderReverseGeocodeStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *geocoderReverseGeocodeStreamClient) Send(m *ReverseGeocodeRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *geocoderReverseGeocodeStreamClient) Recv() (*Location, error) {
+	m := new(Location)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GeocoderServer is the server API for Geocoder service.
+// All implementations must embed UnimplementedGeocoderServer
+// for forward compatibility
+type GeocoderServer interface {
+	// ReverseGeocode returns the location of a point.
+	ReverseGeocode(context.Context, *ReverseGeocodeRequest) (*Location, error)
+	// ReverseGeocodeStream returns the location of each point sent, in the same
+	// order.
+	ReverseGeocodeStream(Geocoder_ReverseGeocodeStreamServer) error
+	mustEmbedUnimplementedGeocoderServer()
+}
+
+// UnimplementedGeocoderServer must be embedded to have forward compatible implementations.
+type UnimplementedGeocoderServer struct {
+}
+
+func (UnimplementedGeocoderServer) ReverseGeocode(context.Context, *ReverseGeocodeRequest) (*Location, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReverseGeocode not implemented")
+}
+func (UnimplementedGeocoderServer) ReverseGeocodeStream(Geocoder_ReverseGeocodeStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ReverseGeocodeStream not implemented")
+}
+func (UnimplementedGeocoderServer) mustEmbedUnimplementedGeocoderServer() {}
+
+// UnsafeGeocoderServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GeocoderServer will
+// result in compilation errors.
+type UnsafeGeocoderServer interface {
+	mustEmbedUnimplementedGeocoderServer()
+}
+
+func RegisterGeocoderServer(s grpc.ServiceRegistrar, srv GeocoderServer) {
+	s.RegisterService(&Geocoder_ServiceDesc, srv)
+}
+
+func _Geocoder_ReverseGeocode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReverseGeocodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GeocoderServer).ReverseGeocode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/salta.v1.Geocoder/ReverseGeocode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GeocoderServer).ReverseGeocode(ctx, req.(*ReverseGeocodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Geocoder_ReverseGeocodeStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GeocoderServer).ReverseGeocodeStream(&geocoderReverseGeocodeStreamServer{stream})
+}
+
+type Geocoder_ReverseGeocodeStreamServer interface {
+	Send(*Location) error
+	Recv() (*ReverseGeocodeRequest, error)
+	grpc.ServerStream
+}
+
+type geocoderReverseGeocodeStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *geocoderReverseGeocodeStreamServer) Send(m *Location) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *geocoderReverseGeocodeStreamServer) Recv() (*ReverseGeocodeRequest, error) {
+	m := new(ReverseGeocodeRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Geocoder_ServiceDesc is the grpc.ServiceDesc for Geocoder service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Geocoder_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "salta.v1.Geocoder",
+	HandlerType: (*GeocoderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ReverseGeocode",
+			Handler:    _Geocoder_ReverseGeocode_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ReverseGeocodeStream",
+			Handler:       _Geocoder_ReverseGeocodeStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "salta.proto",
+}